@@ -0,0 +1,239 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"sort"
+	"sync"
+)
+
+// maxLanes is the most hashes HashBatch computes in lock step
+const maxLanes = 8
+
+// HashBatch hashes each of srcs into the matching dsts, which must be at least HashSize bytes each.
+// The results are identical to calling Hash on each src.
+//
+// Nearly all the time spent hashing with a large ByteMap goes to waiting on random reads of memory,
+// and a single hash can only have one read in flight at a time.  HashBatch runs up to maxLanes hashes
+// of the same length in lock step, so the reads for all of them are in flight together.  Mining, where
+// every input is the same data with a different nonce, is the case it is made for.
+func (lx *LXRHash) HashBatch(srcs [][]byte, dsts [][]byte) {
+	if len(dsts) < len(srcs) {
+		panic("lxr: HashBatch needs a dst for every src")
+	}
+
+	// Group the inputs by length, since only hashes of the same length can run in lock step
+	order := make([]int, len(srcs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return len(srcs[order[a]]) < len(srcs[order[b]]) })
+
+	ls := lanesPool.Get().(*lanes)
+	ls.init(lx)
+	var s, d [maxLanes][]byte
+	for i := 0; i < len(order); {
+		n := 0
+		for ; i < len(order) && n < maxLanes; i, n = i+1, n+1 {
+			if n > 0 && len(srcs[order[i]]) != len(s[0]) {
+				break
+			}
+			s[n], d[n] = srcs[order[i]], dsts[order[i]][:lx.HashSize]
+		}
+		if n == 1 {
+			lx.HashInto(d[0], s[0])
+		} else {
+			ls.hash(n, &s, &d)
+		}
+	}
+	lanesPool.Put(ls)
+}
+
+// lanes holds the state of up to maxLanes hashes of the same length computed in lock step.  It is
+// state, with every field but the ByteMap held once per lane.
+type lanes struct {
+	byteMap  []byte
+	mk       uint64
+	seed     uint64
+	hashSize uint64
+	hs       [maxLanes][]uint64
+	as       [maxLanes]uint64
+	s1       [maxLanes]uint64
+	s2       [maxLanes]uint64
+	s3       [maxLanes]uint64
+}
+
+var lanesPool = sync.Pool{New: func() interface{} { return new(lanes) }}
+
+// init sets up the lanes to hash with the given LXRHash
+func (ls *lanes) init(lx *LXRHash) {
+	ls.byteMap = lx.ByteMap
+	ls.mk = lx.MapSize - 1
+	ls.seed = lx.Seed
+	ls.hashSize = lx.HashSize
+	for k := range ls.hs {
+		if uint64(cap(ls.hs[k])) < lx.HashSize {
+			ls.hs[k] = make([]uint64, lx.HashSize)
+		}
+		ls.hs[k] = ls.hs[k][:lx.HashSize]
+	}
+}
+
+// hash computes the hashes of the first n srcs, which are all the same length, into dsts.
+// Each lane goes through exactly the steps that state.hash does.
+func (ls *lanes) hash(n int, srcs, dsts *[maxLanes][]byte) {
+	for k := 0; k < n; k++ {
+		for i := range ls.hs[k] {
+			ls.hs[k][i] = 0
+		}
+		ls.as[k] = ls.seed
+		ls.s1[k], ls.s2[k], ls.s3[k] = 0, 0, 0
+	}
+
+	var v2 [maxLanes]uint64
+	length := len(srcs[0])
+
+	// Fast spin to prevent caching state
+	idx := uint64(0)
+	for p := 0; p < length; p++ {
+		if idx >= ls.hashSize {
+			idx = 0
+		}
+		for k := 0; k < n; k++ {
+			v2[k] = uint64(srcs[k][p])
+		}
+		ls.faststep(n, &v2, idx)
+		idx++
+	}
+
+	// Actual work to compute the hash
+	idx = 0
+	for p := 0; p < length; p++ {
+		if idx >= ls.hashSize {
+			idx = 0
+		}
+		for k := 0; k < n; k++ {
+			v2[k] = uint64(srcs[k][p])
+		}
+		ls.step(n, &v2, idx)
+		idx++
+	}
+
+	// Reduction pass, as in state.reduce
+	for i := int(ls.hashSize) - 1; i >= 0; i-- {
+		for k := 0; k < n; k++ {
+			v2[k] = ls.hs[k][i]
+		}
+		ls.step(n, &v2, uint64(i))
+		for k := 0; k < n; k++ {
+			dsts[k][i] = ls.byteMap[ls.as[k]&ls.mk] ^ ls.byteMap[ls.hs[k][i]&ls.mk]
+		}
+	}
+}
+
+// faststep is state.faststep for each of n lanes
+func (ls *lanes) faststep(n int, v2 *[maxLanes]uint64, idx uint64) {
+	for k := 0; k < n; k++ {
+		b := uint64(ls.byteMap[(ls.as[k]^v2[k])&ls.mk])
+		ls.as[k] = ls.as[k]<<7 ^ ls.as[k]>>5 ^ v2[k]<<20 ^ v2[k]<<16 ^ v2[k] ^ b<<20 ^ b<<12 ^ b<<4
+		ls.s1[k] = ls.s1[k]<<9 ^ ls.s1[k]>>3 ^ ls.hs[k][idx]
+		ls.hs[k][idx] = ls.s1[k] ^ ls.as[k]
+		ls.s1[k], ls.s2[k], ls.s3[k] = ls.s3[k], ls.s1[k], ls.s2[k]
+	}
+}
+
+// step is state.step for each of n lanes.  Every line of state.step is done for all the lanes before
+// moving to the next, so the ByteMap reads of the lanes are independent of each other.
+func (ls *lanes) step(n int, v2 *[maxLanes]uint64, idx uint64) {
+	byteMap, mk := ls.byteMap, ls.mk
+	B := func(v uint64) uint64 { return uint64(byteMap[v&mk]) }
+	as, s1, s2, s3 := ls.as, ls.s1, ls.s2, ls.s3
+	hs := &ls.hs
+
+	for k := 0; k < n; k++ {
+		s1[k] = s1[k]<<9 ^ s1[k]>>1 ^ as[k] ^ B(as[k]>>5^v2[k])<<3
+	}
+	for k := 0; k < n; k++ {
+		s1[k] = s1[k]<<5 ^ s1[k]>>3 ^ B(s1[k]^v2[k])<<7
+	}
+	for k := 0; k < n; k++ {
+		s1[k] = s1[k]<<7 ^ s1[k]>>7 ^ B(as[k]^s1[k]>>7)<<5
+	}
+	for k := 0; k < n; k++ {
+		s1[k] = s1[k]<<11 ^ s1[k]>>5 ^ B(v2[k]^as[k]>>11^s1[k])<<27
+	}
+	for k := 0; k < n; k++ {
+		hs[k][idx] = s1[k] ^ as[k] ^ hs[k][idx]<<7 ^ hs[k][idx]>>13
+	}
+	for k := 0; k < n; k++ {
+		as[k] = as[k]<<17 ^ as[k]>>5 ^ s1[k] ^ B(as[k]^s1[k]>>27^v2[k])<<3
+	}
+	for k := 0; k < n; k++ {
+		as[k] = as[k]<<13 ^ as[k]>>3 ^ B(as[k]^s1[k])<<7
+	}
+	for k := 0; k < n; k++ {
+		as[k] = as[k]<<15 ^ as[k]>>7 ^ B(as[k]>>7^s1[k])<<11
+	}
+	for k := 0; k < n; k++ {
+		as[k] = as[k]<<9 ^ as[k]>>11 ^ B(v2[k]^as[k]^s1[k])<<3
+	}
+	for k := 0; k < n; k++ {
+		s1[k] = s1[k]<<7 ^ s1[k]>>27 ^ as[k] ^ B(as[k]>>3)<<13
+	}
+	for k := 0; k < n; k++ {
+		s1[k] = s1[k]<<3 ^ s1[k]>>13 ^ B(s1[k]^v2[k])<<11
+	}
+	for k := 0; k < n; k++ {
+		s1[k] = s1[k]<<8 ^ s1[k]>>11 ^ B(as[k]^s1[k]>>11)<<9
+	}
+	for k := 0; k < n; k++ {
+		s1[k] = s1[k]<<6 ^ s1[k]>>9 ^ B(v2[k]^as[k]^s1[k])<<3
+	}
+	for k := 0; k < n; k++ {
+		as[k] = as[k]<<23 ^ as[k]>>3 ^ s1[k] ^ B(as[k]^v2[k]^s1[k]>>3)<<7
+	}
+	for k := 0; k < n; k++ {
+		as[k] = as[k]<<17 ^ as[k]>>7 ^ B(as[k]^s1[k]>>3)<<5
+	}
+	for k := 0; k < n; k++ {
+		as[k] = as[k]<<13 ^ as[k]>>5 ^ B(as[k]>>5^s1[k])<<1
+	}
+	for k := 0; k < n; k++ {
+		as[k] = as[k]<<11 ^ as[k]>>1 ^ B(v2[k]^as[k]^s1[k])<<7
+	}
+
+	for k := 0; k < n; k++ {
+		s1[k] = s1[k]<<5 ^ s1[k]>>3 ^ as[k] ^ B(as[k]>>7^s1[k]>>3)<<6
+	}
+	for k := 0; k < n; k++ {
+		s1[k] = s1[k]<<8 ^ s1[k]>>6 ^ B(s1[k]^v2[k])<<11
+	}
+	for k := 0; k < n; k++ {
+		s1[k] = s1[k]<<11 ^ s1[k]>>11 ^ B(as[k]^s1[k]>>11)<<5
+	}
+	for k := 0; k < n; k++ {
+		s1[k] = s1[k]<<7 ^ s1[k]>>5 ^ B(v2[k]^as[k]>>7^as[k]^s1[k])<<17
+	}
+
+	for k := 0; k < n; k++ {
+		s2[k] = s2[k]<<3 ^ s2[k]>>17 ^ s1[k] ^ B(as[k]^s2[k]>>5^v2[k])<<13
+	}
+	for k := 0; k < n; k++ {
+		s2[k] = s2[k]<<6 ^ s2[k]>>13 ^ B(s2[k])<<11
+	}
+	for k := 0; k < n; k++ {
+		s2[k] = s2[k]<<11 ^ s2[k]>>11 ^ B(as[k]^s1[k]^s2[k]>>11)<<23
+	}
+	for k := 0; k < n; k++ {
+		s2[k] = s2[k]<<4 ^ s2[k]>>23 ^ B(v2[k]^as[k]>>8^as[k]^s2[k]>>10)<<1
+	}
+
+	for k := 0; k < n; k++ {
+		s1[k] = s2[k]<<3 ^ s2[k]>>1 ^ hs[k][idx] ^ v2[k]
+	}
+	for k := 0; k < n; k++ {
+		as[k] = as[k]<<9 ^ as[k]>>7 ^ s1[k]>>1 ^ B(s2[k]>>1^hs[k][idx])<<5
+	}
+
+	ls.as, ls.s1, ls.s2, ls.s3 = as, s3, s1, s2
+}
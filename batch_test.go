@@ -0,0 +1,69 @@
+package lxr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestLXRHash_HashBatch(t *testing.T) {
+	l := new(LXRHash)
+	l.Init(Seed, 10, HashSize, Passes)
+
+	r := rand.New(rand.NewSource(1))
+	for _, count := range []int{0, 1, 2, 5, 8, 9, 20} {
+		srcs := make([][]byte, count)
+		dsts := make([][]byte, count)
+		for i := range srcs {
+			// A mix of lengths, with most the same as they are when mining
+			length := 40
+			if r.Intn(3) == 0 {
+				length = r.Intn(100)
+			}
+			srcs[i] = make([]byte, length)
+			r.Read(srcs[i])
+			dsts[i] = make([]byte, l.HashSize)
+		}
+		l.HashBatch(srcs, dsts)
+		for i := range srcs {
+			if want := l.Hash(srcs[i]); !bytes.Equal(dsts[i], want) {
+				t.Errorf("[%d of %d] mismatch. got = %x, want = %x", i, count, dsts[i], want)
+			}
+		}
+	}
+}
+
+func BenchmarkHashBatch(b *testing.B) {
+	srcs := make([][]byte, maxLanes)
+	dsts := make([][]byte, maxLanes)
+	for i := range srcs {
+		srcs[i] = append(append([]byte{}, oprhash...), 0, 0, 0, 0)
+		dsts[i] = make([]byte, lx.HashSize)
+	}
+	nonce := uint32(0)
+	next := func(src []byte) {
+		nonce++
+		binary.LittleEndian.PutUint32(src[len(oprhash):], nonce)
+	}
+
+	// Each op is one hash in all cases, so ns/op compares directly
+	b.Run("serial", func(b *testing.B) {
+		s := lx.NewScratch()
+		for i := 0; i < b.N; i++ {
+			next(srcs[0])
+			s.HashInto(dsts[0], srcs[0])
+		}
+	})
+	for _, n := range []int{2, 4, 8} {
+		b.Run(fmt.Sprintf("lanes-%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i += n {
+				for j := 0; j < n; j++ {
+					next(srcs[j])
+				}
+				lx.HashBatch(srcs[:n], dsts[:n])
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import "math"
+
+// two64 is 2^64, the number of possible difficulties
+var two64 = math.Ldexp(1, 64)
+
+// Difficulty is the top 8 bytes of hash as a big endian number.  Consider a bigger number to be more
+// difficult.  (This is a bit different than most PoW.  It is the same as viewing the value as signed,
+// and saying a smaller value is more difficult, due to the nature of signed values in binary.)
+// A hash shorter than 8 bytes is treated as if it were padded with zeros.
+func Difficulty(hash []byte) uint64 {
+	diff := uint64(0)
+	for i := 0; i < 8; i++ {
+		diff = diff << 8
+		if i < len(hash) {
+			diff += uint64(hash[i])
+		}
+	}
+	return diff
+}
+
+// MeetsTarget reports if hash has a difficulty of at least target
+func MeetsTarget(hash []byte, target uint64) bool {
+	return Difficulty(hash) >= target
+}
+
+// Work is the expected number of hashes it takes to find one with at least the given difficulty.
+// A difficulty of 0 takes 1 hash, 0x8000000000000000 takes 2, 0xC000000000000000 takes 4, and so on.
+func Work(difficulty uint64) float64 {
+	// 2^64 / (2^64 - difficulty), where 2^64 - difficulty is ^difficulty + 1
+	return two64 / (float64(^difficulty) + 1)
+}
+
+// DifficultyForWork is the inverse of Work.  It returns the difficulty that takes the given
+// expected number of hashes to find.
+func DifficultyForWork(work float64) uint64 {
+	if work <= 1 {
+		return 0
+	}
+	d := two64 - two64/work
+	if d >= two64 {
+		return math.MaxUint64
+	}
+	return uint64(d)
+}
+
+// CumulativeWork is the total of the work shown by a set of hashes, i.e. the shares submitted by a miner
+func CumulativeWork(hashes [][]byte) float64 {
+	total := float64(0)
+	for _, h := range hashes {
+		total += Work(Difficulty(h))
+	}
+	return total
+}
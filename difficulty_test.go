@@ -0,0 +1,59 @@
+package lxr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestDifficulty(t *testing.T) {
+	tests := []struct {
+		hash []byte
+		want uint64
+	}{
+		{[]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0xFF}, 0x0102030405060708},
+		{[]byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, math.MaxUint64},
+		{[]byte{0xAB, 0xCD}, 0xABCD000000000000},
+		{nil, 0},
+	}
+	for _, tt := range tests {
+		if got := Difficulty(tt.hash); got != tt.want {
+			t.Errorf("Difficulty(%x) = %x, want = %x", tt.hash, got, tt.want)
+		}
+	}
+
+	hash := []byte{0x80, 0, 0, 0, 0, 0, 0, 1}
+	if !MeetsTarget(hash, 0x8000000000000001) || MeetsTarget(hash, 0x8000000000000002) {
+		t.Errorf("MeetsTarget wrong at the boundary")
+	}
+}
+
+func TestWork(t *testing.T) {
+	tests := map[uint64]float64{
+		0:                  1,
+		0x8000000000000000: 2,
+		0xC000000000000000: 4,
+		0xFFFF000000000000: 65536,
+		math.MaxUint64:     math.Ldexp(1, 64),
+	}
+	for d, want := range tests {
+		if got := Work(d); got != want {
+			t.Errorf("Work(%x) = %f, want = %f", d, got, want)
+		}
+		if d != math.MaxUint64 {
+			if got := DifficultyForWork(want); got != d {
+				t.Errorf("DifficultyForWork(%f) = %x, want = %x", want, got, d)
+			}
+		}
+	}
+	if got := DifficultyForWork(0.5); got != 0 {
+		t.Errorf("DifficultyForWork(0.5) = %x, want = 0", got)
+	}
+	if got := DifficultyForWork(math.Inf(1)); got != math.MaxUint64 {
+		t.Errorf("DifficultyForWork(+Inf) = %x, want = max", got)
+	}
+
+	hashes := [][]byte{{0}, {0x80}, {0xC0}}
+	if got := CumulativeWork(hashes); got != 7 {
+		t.Errorf("CumulativeWork = %f, want = 7", got)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+)
+
+// A table that is the right size, balanced, and even has a valid header, can still be the wrong table,
+// i.e. one generated by a build with a bug, or damaged before its header was written.  Hashes made
+// with it would be wrong, and its node would disagree with every other node.  So the sha256 of the
+// ByteMap is checked against a known digest, where there is one, whenever a table is loaded or
+// generated.
+
+// defaultDigests are the sha256 of the ByteMaps for the default Seed and Passes, from 8 bits up
+var defaultDigests = []string{
+	"9855b17b807c041622d0f984b6004da28f0554b574f17de788abaa6a38135483", // 8 bits
+	"f20da12d938c0d46813e7b63003b8b0852534516336c123c15e9c30803ea915c", // 9 bits
+	"c1e50b47f68732bce96e3a01bf53d889071ef31b5732c3f07f460c6aa4adf204", // 10 bits
+	"2dc2a012b81ae4056a00b51c944f0b1da093bd51a09d38c4f4223e2d6dbbd487", // 11 bits
+	"6b6690d7d31ae6ac0d8d99dd5ba129a9d885e5c32cd38d698e062f835b6ed6d7", // 12 bits
+	"ddce0db9ae6d1c28499d5040a68819ab75a40dc3ce3cc08c43ac880c83876b46", // 13 bits
+	"fd165c4eaffceca276ef62599dbcef25667528899cf268d163fdbfa4c916a576", // 14 bits
+	"c59ce08a0201d5643d76f295e5ca59bd2378591b7bee236df8fcd6927c832485", // 15 bits
+	"7f5df9e4cd8216cabbbd73ce203a0073357a3e8941d32e0adbb65bd32b214461", // 16 bits
+	"007af4fbf089a6f87742583ea02cb968ed49111032f497fae26b3d0b129b4456", // 17 bits
+	"d6a6c1073c7f6d2f6aecc07794e0ff59239118e4e88d63698922f138a18a9ff8", // 18 bits
+	"749529594f029b332f20cf71b8253d2eb3d9721e96029c6efa2e1851c5dce092", // 19 bits
+	"e1369a997f98c3d4dbcf85e0c52b759f7daa57654190665ca62baf05037ea957", // 20 bits
+	"ba22a4a07814784483ba7d6068271b3ea39f82c2cb8b57304f83a80c18308c4b", // 21 bits
+	"9abc378313108b7296bc165d99846cd91d444f45b5be91b2f6fd7c609bd44ee6", // 22 bits
+	"5f6a6fb2b080fedead19ea3681ffddbf17c7e95116f566edb5f88c146a7aaba3", // 23 bits
+	"7d3c0fcbd14067ef7540bef9d46dd676ee216243f1d5daf2607d855d88f3c968", // 24 bits
+	"387673fa9a1e7f8ab5cbeee5a2985bc4ee3b70c3fe56212a7f922d8282a009de", // 25 bits
+	"691cc7be73085a995590a43a1214292a517948e53f57b27737d76005fb2014eb", // 26 bits
+	"759635aae8955f1941a631dad299aaa26f082a7010f891fb25b773bfd6814fc5", // 27 bits
+	"eaabc8177dfcb57b951bba8d7b41a808990cf9c70d931c83cc2e391879fc8c7c", // 28 bits
+	"d08a7d1ed93660bd0346d17557dbe8ac4c499096480c796c93f7c54daf535b29", // 29 bits
+	"55a02ed711747012e92fe70424ed1904de6af0b8def259cc068616b86684e93f", // 30 bits
+}
+
+// tableKey identifies a ByteMap.  HashSize doesn't change the ByteMap, so it isn't part of the key.
+type tableKey struct {
+	seed, passes, bits uint64
+}
+
+var digestMtx sync.RWMutex
+var knownDigests = make(map[tableKey][]byte)
+
+func init() {
+	for i, s := range defaultDigests {
+		d, err := hex.DecodeString(s)
+		if err != nil {
+			panic(err)
+		}
+		knownDigests[tableKey{Seed, Passes, uint64(8 + i)}] = d
+	}
+}
+
+// RegisterDigest adds the sha256 of the ByteMap for p to the known digests, so tables for p are checked
+// against it when they are loaded or generated.  HashSize is ignored.  Registering the digest already
+// known for p does nothing, while registering a different one is an error.
+func RegisterDigest(p Params, digest []byte) error {
+	if len(digest) != sha256.Size {
+		return fmt.Errorf("lxr: digest is %d bytes, expected %d", len(digest), sha256.Size)
+	}
+	key := tableKey{p.Seed, p.Passes, p.MapSizeBits}
+
+	digestMtx.Lock()
+	defer digestMtx.Unlock()
+	if known, ok := knownDigests[key]; ok {
+		if !bytes.Equal(known, digest) {
+			return fmt.Errorf("lxr: a different digest is known for seed %x, passes %d, size %d", p.Seed, p.Passes, p.MapSizeBits)
+		}
+		return nil
+	}
+	knownDigests[key] = append([]byte{}, digest...)
+	return nil
+}
+
+// KnownDigest returns the sha256 of the ByteMap for p, if it is known.  HashSize is ignored.
+func KnownDigest(p Params) ([]byte, bool) {
+	digestMtx.RLock()
+	defer digestMtx.RUnlock()
+	d, ok := knownDigests[tableKey{p.Seed, p.Passes, p.MapSizeBits}]
+	if !ok {
+		return nil, false
+	}
+	return append([]byte{}, d...), true
+}
+
+// checkDigest returns ErrTableCorrupt if sum, the sha256 of a ByteMap for lx, is not its known digest
+func (lx *LXRHash) checkDigest(sum []byte) error {
+	if known, ok := KnownDigest(lx.Params()); ok && !bytes.Equal(sum, known) {
+		return fmt.Errorf("%w: ByteMap digest %x is not the known digest %x", ErrTableCorrupt, sum, known)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package lxr
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestKnownDigest(t *testing.T) {
+	for bits := uint64(8); bits <= 30; bits++ {
+		p := DefaultParams
+		p.MapSizeBits = bits
+		if d, ok := KnownDigest(p); !ok || len(d) != sha256.Size {
+			t.Errorf("no digest known for %d bits", bits)
+		}
+	}
+	if d, ok := KnownDigest(Params{Seed: Seed ^ 1, MapSizeBits: 8, Passes: Passes}); ok || d != nil {
+		t.Errorf("digest known for an unknown seed: %x", d)
+	}
+
+	// The known digests are the digests of the tables GenerateTable makes
+	for bits := uint64(8); bits <= 16; bits++ {
+		l := &LXRHash{Seed: Seed, MapSize: 1 << bits, MapSizeBits: bits, Passes: Passes, HashSize: HashSize / 8}
+		l.GenerateTable()
+		sum := sha256.Sum256(l.ByteMap)
+		if d, _ := KnownDigest(l.Params()); !bytes.Equal(d, sum[:]) {
+			t.Errorf("[%d] known digest %x, generated table is %x", bits, d, sum)
+		}
+	}
+}
+
+func TestRegisterDigest(t *testing.T) {
+	// Seeds of their own, as registered digests can't be taken back
+	p := Params{Seed: Seed + 2, MapSizeBits: 8, HashSize: HashSize, Passes: Passes}
+	bogus := Params{Seed: Seed + 3, MapSizeBits: 8, HashSize: HashSize, Passes: Passes}
+	dir := t.TempDir()
+
+	l, err := NewParams(p, WithDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(l.ByteMap)
+
+	if err := RegisterDigest(p, sum[:4]); err == nil {
+		t.Error("registered a short digest")
+	}
+	if err := RegisterDigest(p, sum[:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterDigest(p, sum[:]); err != nil {
+		t.Errorf("registering the same digest again failed: %v", err)
+	}
+	if err := RegisterDigest(DefaultParams, sum[:]); err == nil {
+		t.Error("replaced a built in digest")
+	}
+	if d, ok := KnownDigest(p); !ok || !bytes.Equal(d, sum[:]) {
+		t.Errorf("KnownDigest() = %x, want %x", d, sum)
+	}
+
+	// A table that doesn't match the registered digest is rejected, even without a header
+	legacy := append([]byte{}, l.ByteMap...)
+	i := 1
+	for legacy[i] == legacy[0] {
+		i++
+	}
+	legacy[0], legacy[i] = legacy[i], legacy[0]
+	if err := ioutil.WriteFile(filepath.Join(dir, l.tableName()), legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewParams(p, WithDir(dir), WithReadOnly(true)); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("expected ErrTableCorrupt for a table that isn't the known table, got %v", err)
+	}
+	if _, err := NewParams(p, WithDir(dir)); err != nil {
+		t.Errorf("bad table was not replaced: %v", err)
+	}
+	if r, err := VerifyTableContext(context.Background(), p, VerifyOptions{Dir: dir}); err != nil || !r.OK() || !r.DigestMatch {
+		t.Errorf("replaced table failed verification: %v %q", err, r.Problems)
+	}
+
+	// A generated table that doesn't match means the generator is broken
+	if err := RegisterDigest(bogus, make([]byte, sha256.Size)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewParams(bogus, WithDir(dir)); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("expected ErrTableCorrupt for a generated table that isn't the known table, got %v", err)
+	}
+}
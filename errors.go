@@ -0,0 +1,23 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import "errors"
+
+// Errors returned by New, Verify, and the other error returning functions.  Returned errors wrap one of
+// these, so test for them with errors.Is.
+var (
+	ErrBadMapSize         = errors.New("lxr: bad map size")        // MapSizeBits is out of range
+	ErrBadHashSize        = errors.New("lxr: bad hash size")       // HashSize is out of range
+	ErrInsufficientMemory = errors.New("lxr: insufficient memory") // Not enough memory is available for the ByteMap
+	ErrTableIO            = errors.New("lxr: table i/o error")     // The ByteMap table could not be read or written
+	ErrTableCorrupt       = errors.New("lxr: table is corrupt")    // A ByteMap table file failed validation
+	ErrLockTimeout        = errors.New("lxr: table lock timeout")  // Another process held the table lock too long
+
+	ErrParamsMismatch         = errors.New("lxr: parameters do not match") // A hash was made with other parameters
+	ErrHashMismatch           = errors.New("lxr: hash does not match")     // A claimed hash is not the hash of its data
+	ErrInsufficientDifficulty = errors.New("lxr: insufficient difficulty") // A hash is below the required difficulty
+)
+
+// errNoMmap is returned by mmapFile on platforms without memory mapped tables
+var errNoMmap = errors.New("memory mapped tables are not supported on this platform")
@@ -0,0 +1,108 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+// Table files are written with a header in front of the ByteMap, so a damaged or mismatched file
+// is detected when it is loaded rather than silently producing wrong hashes.  Files written before
+// the header was introduced are just the ByteMap, and are still accepted.
+//
+// Header layout, integers are little endian:
+//
+//	 0  magic         "LXRH"
+//	 4  version       uint32
+//	 8  seed          uint64
+//	16  passes        uint64
+//	24  map size bits uint64
+//	32  sha256 of the ByteMap
+//	64  ByteMap
+const (
+	TableFormatVersion = uint32(2) // Version of the table file format written by WriteTable
+	tableHeaderSize    = 64
+)
+
+var tableMagic = []byte("LXRH")
+
+// tableHeader returns the header for a table file holding the ByteMap of lx
+func (lx *LXRHash) tableHeader() []byte {
+	h := make([]byte, tableHeaderSize)
+	copy(h[0:4], tableMagic)
+	binary.LittleEndian.PutUint32(h[4:8], TableFormatVersion)
+	binary.LittleEndian.PutUint64(h[8:16], lx.Seed)
+	binary.LittleEndian.PutUint64(h[16:24], lx.Passes)
+	binary.LittleEndian.PutUint64(h[24:32], lx.MapSizeBits)
+	sum := sha256.Sum256(lx.ByteMap)
+	copy(h[32:64], sum[:])
+	return h
+}
+
+// tableFileHeader holds the fields of the header of a table file
+type tableFileHeader struct {
+	Version     uint32
+	Seed        uint64
+	Passes      uint64
+	MapSizeBits uint64
+	Sum         []byte // sha256 of the ByteMap
+}
+
+// isLegacyTable returns true if dat is a table file written before the header, holding a ByteMap of
+// mapSize bytes and nothing else
+func isLegacyTable(dat []byte, mapSize uint64) bool {
+	return uint64(len(dat)) == mapSize && !bytes.HasPrefix(dat, tableMagic)
+}
+
+// parseTableHeader splits a table file with a header into the header and the ByteMap.  It returns an
+// error if dat has no header, or is in a version of the format it can't read, in which case only the
+// Version of the header is set, if that.  Nothing is checked against the ByteMap.
+func parseTableHeader(dat []byte) (hdr tableFileHeader, byteMap []byte, err error) {
+	if len(dat) < tableHeaderSize || !bytes.Equal(dat[0:4], tableMagic) {
+		return hdr, nil, fmt.Errorf("not a table file: no header in %d bytes", len(dat))
+	}
+	hdr.Version = binary.LittleEndian.Uint32(dat[4:8])
+	if hdr.Version != TableFormatVersion {
+		return hdr, nil, fmt.Errorf("unsupported format version %d", hdr.Version)
+	}
+	hdr.Seed = binary.LittleEndian.Uint64(dat[8:16])
+	hdr.Passes = binary.LittleEndian.Uint64(dat[16:24])
+	hdr.MapSizeBits = binary.LittleEndian.Uint64(dat[24:32])
+	hdr.Sum = dat[32:64]
+	return hdr, dat[tableHeaderSize:], nil
+}
+
+// decodeTable checks the contents of a table file against the parameters of lx, and the known digest
+// for them if there is one, and returns the ByteMap it holds.  Legacy files without a header are
+// accepted if they are the right size.
+func (lx *LXRHash) decodeTable(dat []byte) ([]byte, error) {
+	if isLegacyTable(dat, lx.MapSize) {
+		if _, ok := KnownDigest(lx.Params()); ok {
+			sum := sha256.Sum256(dat)
+			if err := lx.checkDigest(sum[:]); err != nil {
+				return nil, err
+			}
+		}
+		return dat, nil
+	}
+	hdr, byteMap, err := parseTableHeader(dat)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTableCorrupt, err)
+	}
+	if hdr.Seed != lx.Seed || hdr.Passes != lx.Passes || hdr.MapSizeBits != lx.MapSizeBits {
+		return nil, fmt.Errorf("%w: table is for seed %x, passes %d, size %d", ErrTableCorrupt, hdr.Seed, hdr.Passes, hdr.MapSizeBits)
+	}
+	if uint64(len(byteMap)) != lx.MapSize {
+		return nil, fmt.Errorf("%w: ByteMap is %d bytes, expected %d", ErrTableCorrupt, len(byteMap), lx.MapSize)
+	}
+	if sum := sha256.Sum256(byteMap); !bytes.Equal(sum[:], hdr.Sum) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrTableCorrupt)
+	}
+	if err := lx.checkDigest(hdr.Sum); err != nil {
+		return nil, err
+	}
+	return byteMap, nil
+}
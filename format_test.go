@@ -0,0 +1,46 @@
+package lxr
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestLXRHash_decodeTable(t *testing.T) {
+	l := new(LXRHash)
+	l.Init(Seed, 8, HashSize, Passes)
+
+	file := append(l.tableHeader(), l.ByteMap...)
+	if bm, err := l.decodeTable(file); err != nil || !bytes.Equal(bm, l.ByteMap) {
+		t.Errorf("failed to decode a valid table: %v", err)
+	}
+	if bm, err := l.decodeTable(append([]byte{}, l.ByteMap...)); err != nil || !bytes.Equal(bm, l.ByteMap) {
+		t.Errorf("failed to decode a legacy table: %v", err)
+	}
+
+	bad := map[string][]byte{
+		"empty":     {},
+		"truncated": file[:len(file)-1],
+		"header":    file[:tableHeaderSize],
+		"legacy":    l.ByteMap[:len(l.ByteMap)-1],
+		"long":      append(append([]byte{}, file...), 0),
+	}
+	flip := func(i int) []byte {
+		f := append([]byte{}, file...)
+		f[i] ^= 1
+		return f
+	}
+	bad["magic"] = flip(0)
+	bad["version"] = flip(4)
+	bad["seed"] = flip(8)
+	bad["passes"] = flip(16)
+	bad["bits"] = flip(24)
+	bad["checksum"] = flip(40)
+	bad["bytemap"] = flip(tableHeaderSize + 100)
+
+	for name, f := range bad {
+		if _, err := l.decodeTable(f); !errors.Is(err, ErrTableCorrupt) {
+			t.Errorf("[%s] expected ErrTableCorrupt, got %v", name, err)
+		}
+	}
+}
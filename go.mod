@@ -1,6 +1,6 @@
 module github.com/pegnet/LXRHash
 
-go 1.12
+go 1.17
 
 require (
 	github.com/BurntSushi/toml v0.3.1 // indirect
@@ -0,0 +1,139 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// DefaultSpoolMemory is the number of bytes a Hasher keeps in memory before spilling to a temporary file
+const DefaultSpoolMemory = 32 << 20
+
+// Hasher computes an LXRHash over data written to it in pieces, and implements hash.Hash.
+// The result of Sum is identical to calling Hash on all the bytes written.
+//
+// Hash makes two passes over its source.  The fast spin is done as the data is written.  The second
+// pass needs the state left by the fast spin over all the data, so it can only start when Sum is
+// called.  Until then, the written data is spooled: up to SpoolMemory bytes are kept in memory, and
+// anything beyond that is spilled to a temporary file in SpoolDir.  Call Close (or Reset) when done
+// with a Hasher to remove the temporary file.
+type Hasher struct {
+	SpoolDir    string // Directory for the spill file.  Defaults to os.TempDir()
+	SpoolMemory int    // Bytes kept in memory before spilling.  Defaults to DefaultSpoolMemory
+
+	st   state  // State after the fast spin over everything written
+	mem  []byte // Spooled data held in memory
+	file *os.File
+}
+
+// NewHasher returns a streaming Hasher that computes the same hash as lx.Hash
+func (lx *LXRHash) NewHasher() *Hasher {
+	h := new(Hasher)
+	h.SpoolMemory = DefaultSpoolMemory
+	h.st.init(lx)
+	return h
+}
+
+// Write adds more data to the hash.  It only returns an error if the data cannot be spooled, after
+// which the Hasher must be Reset before it is used again.
+func (h *Hasher) Write(p []byte) (int, error) {
+	if h.file == nil && len(h.mem)+len(p) > h.SpoolMemory {
+		if err := h.spill(); err != nil {
+			return 0, err
+		}
+	}
+	if h.file != nil {
+		if n, err := h.file.Write(p); err != nil {
+			return n, fmt.Errorf("error spooling hash data: %v", err)
+		}
+	} else {
+		h.mem = append(h.mem, p...)
+	}
+	h.st.fast(p)
+	return len(p), nil
+}
+
+// spill moves the data spooled in memory to a temporary file
+func (h *Hasher) spill() error {
+	f, err := ioutil.TempFile(h.SpoolDir, "lxrhash-spool")
+	if err != nil {
+		return fmt.Errorf("error creating hash spool file: %v", err)
+	}
+	if _, err := f.Write(h.mem); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return fmt.Errorf("error spooling hash data: %v", err)
+	}
+	h.file = f
+	h.mem = nil
+	return nil
+}
+
+// Sum appends the hash of the data written so far to b.  It does not change the underlying state,
+// so more data can be written afterwards.
+//
+// Sum panics if spooled data cannot be read back from the spill file.
+func (h *Hasher) Sum(b []byte) []byte {
+	var st state
+	st.copyFrom(&h.st)
+	st.idx = 0
+
+	if h.file != nil {
+		if _, err := h.file.Seek(0, io.SeekStart); err != nil {
+			panic(fmt.Sprintf("error reading hash spool file: %v", err))
+		}
+		buf := make([]byte, 64*1024)
+		for {
+			n, err := h.file.Read(buf)
+			st.slow(buf[:n])
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				panic(fmt.Sprintf("error reading hash spool file: %v", err))
+			}
+		}
+		if _, err := h.file.Seek(0, io.SeekEnd); err != nil {
+			panic(fmt.Sprintf("error reading hash spool file: %v", err))
+		}
+	} else {
+		st.slow(h.mem)
+	}
+
+	start := len(b)
+	for i := uint64(0); i < st.hashSize; i++ {
+		b = append(b, 0)
+	}
+	st.reduce(b[start:])
+	return b
+}
+
+// Reset discards everything written and removes the spill file, if any
+func (h *Hasher) Reset() {
+	h.Close()
+	h.mem = h.mem[:0]
+	h.st.reset()
+}
+
+// Close removes the spill file, if any.  The Hasher must be Reset before it is used again.
+func (h *Hasher) Close() error {
+	if h.file == nil {
+		return nil
+	}
+	name := h.file.Name()
+	err := h.file.Close()
+	h.file = nil
+	if rerr := os.Remove(name); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// Size returns the number of bytes Sum will append
+func (h *Hasher) Size() int { return int(h.st.hashSize) }
+
+// BlockSize returns the number of bytes of source that cycle through the hash state
+func (h *Hasher) BlockSize() int { return int(h.st.hashSize) }
@@ -0,0 +1,97 @@
+package lxr
+
+import (
+	"bytes"
+	"hash"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+var _ hash.Hash = (*Hasher)(nil)
+
+func TestHasher(t *testing.T) {
+	l := new(LXRHash)
+	l.Init(Seed, 8, HashSize, Passes)
+
+	r := rand.New(rand.NewSource(1))
+	for _, size := range []int{0, 1, 31, 32, 33, 100, 1000, 5000} {
+		src := make([]byte, size)
+		r.Read(src)
+		want := l.Hash(src)
+
+		h := l.NewHasher()
+		for i := 0; i < len(src); {
+			n := r.Intn(70)
+			if i+n > len(src) {
+				n = len(src) - i
+			}
+			h.Write(src[i : i+n])
+			i += n
+		}
+		if got := h.Sum(nil); !bytes.Equal(got, want) {
+			t.Errorf("[%d] mismatch. got = %x, want = %x", size, got, want)
+		}
+		// Sum must not change the state
+		if got := h.Sum([]byte{1, 2}); !bytes.Equal(got[2:], want) || got[0] != 1 || got[1] != 2 {
+			t.Errorf("[%d] second sum mismatch. got = %x, want = %x", size, got, want)
+		}
+
+		h.Reset()
+		h.Write(src)
+		if got := h.Sum(nil); !bytes.Equal(got, want) {
+			t.Errorf("[%d] mismatch after reset. got = %x, want = %x", size, got, want)
+		}
+	}
+}
+
+func TestHasher_Spill(t *testing.T) {
+	l := new(LXRHash)
+	l.Init(Seed, 8, HashSize, Passes)
+
+	dir, err := ioutil.TempDir("", "lxrspool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := make([]byte, 200000)
+	rand.New(rand.NewSource(2)).Read(src)
+
+	h := l.NewHasher()
+	h.SpoolDir = dir
+	h.SpoolMemory = 1000
+	summed := false
+	for i := 0; i < len(src); i += 999 {
+		j := i + 999
+		if j > len(src) {
+			j = len(src)
+		}
+		if _, err := h.Write(src[i:j]); err != nil {
+			t.Fatal(err)
+		}
+		// Sum once half way through, after the data has spilled, then keep writing
+		if !summed && j >= len(src)/2 {
+			summed = true
+			if !bytes.Equal(h.Sum(nil), l.Hash(src[:j])) {
+				t.Errorf("mismatch for spilled hash half way through")
+			}
+		}
+	}
+	if !summed {
+		t.Errorf("never summed half way through")
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected one spool file, found %d", len(files))
+	}
+	if !bytes.Equal(h.Sum(nil), l.Hash(src)) {
+		t.Errorf("mismatch for spilled hash")
+	}
+	if err := h.Close(); err != nil {
+		t.Error(err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("spool file not removed on close")
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+package lxr
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+const (
+	hugePageSize = 2 << 20
+	madvHugePage = 14 // MADV_HUGEPAGE, which the syscall package does not define
+)
+
+// adviseHugePages asks the kernel to back b with transparent huge pages.  Shuffling a large ByteMap
+// touches it at random, and with 4K pages much of the time goes to TLB misses.  This is only advice,
+// so failures are ignored.
+func adviseHugePages(b []byte) {
+	if len(b) < 2*hugePageSize {
+		return
+	}
+	addr := uintptr(unsafe.Pointer(&b[0]))
+	off := int((hugePageSize - addr%hugePageSize) % hugePageSize)
+	syscall.Madvise(b[off:], madvHugePage)
+}
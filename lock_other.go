@@ -0,0 +1,18 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package lxr
+
+import (
+	"context"
+	"time"
+)
+
+// lockFile does nothing on this platform.  Processes starting together may each generate the table,
+// but since tables are written atomically, the result is still a valid table.
+func lockFile(ctx context.Context, filename string, timeout time.Duration) (func(), error) {
+	return func() {}, nil
+}
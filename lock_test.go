@@ -0,0 +1,66 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package lxr
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLockFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrlock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "table.lock")
+
+	unlock, err := lockFile(context.Background(), filename, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lockFile(context.Background(), filename, 200*time.Millisecond); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("expected ErrLockTimeout while the lock is held, got %v", err)
+	}
+
+	// A waiting locker gets the lock once it is released
+	done := make(chan error)
+	go func() {
+		unlock2, err := lockFile(context.Background(), filename, 5*time.Second)
+		if err == nil {
+			unlock2()
+		}
+		done <- err
+	}()
+	time.Sleep(300 * time.Millisecond)
+	unlock()
+	if err := <-done; err != nil {
+		t.Errorf("waiting locker failed: %v", err)
+	}
+}
+
+func TestNew_LockTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "lxrhash-seed-fafaececfafaecec-passes-5-size-8.dat")
+	unlock, err := lockFile(context.Background(), filename+".lock", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	opts := Options{Seed: Seed, MapSizeBits: 8, HashSize: HashSize, Passes: Passes, Dir: dir, LockTimeout: 200 * time.Millisecond}
+	if _, err := New(opts); !errors.Is(err, ErrLockTimeout) {
+		t.Errorf("expected ErrLockTimeout while another process generates the table, got %v", err)
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+)
+
+// Level is the severity of a log event
+type Level int
+
+const (
+	LevelDebug Level = iota - 1 // Detail only of interest when debugging
+	LevelInfo                   // Progress of loading and generating tables
+	LevelWarn                   // Something went wrong, but the LXRHash recovered
+	LevelError                  // Something went wrong that the LXRHash could not recover from
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// Logger receives the log events of an LXRHash.  kv holds alternating keys and values that add
+// structure to the event, such as the path of a table or the pass being shuffled.
+type Logger interface {
+	Log(level Level, msg string, kv ...interface{})
+}
+
+// LoggerFunc adapts a function to the Logger interface
+type LoggerFunc func(level Level, msg string, kv ...interface{})
+
+// Log calls f
+func (f LoggerFunc) Log(level Level, msg string, kv ...interface{}) { f(level, msg, kv...) }
+
+// NewStdLogger returns a Logger that writes events at or above min to l, as the message followed by
+// key=value pairs.
+func NewStdLogger(l *log.Logger, min Level) Logger {
+	return LoggerFunc(func(level Level, msg string, kv ...interface{}) {
+		if level >= min {
+			l.Print(level.String() + " " + FormatEvent(msg, kv))
+		}
+	})
+}
+
+// newConsoleLogger returns the Logger used by Verbose, which prints every event to w
+func newConsoleLogger(w io.Writer) Logger {
+	return LoggerFunc(func(level Level, msg string, kv ...interface{}) {
+		fmt.Fprintln(w, FormatEvent(msg, kv))
+	})
+}
+
+// FormatEvent renders a message and its key value pairs on one line, as the Loggers of this package do.
+// A key without a value is written on its own.
+func FormatEvent(msg string, kv []interface{}) string {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(kv); i += 2 {
+		if i+1 < len(kv) {
+			fmt.Fprintf(&b, " %v=%v", kv[i], kv[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", kv[i])
+		}
+	}
+	return b.String()
+}
+
+// SetLogger sets the Logger that receives the log events of lx.  A nil Logger silences lx.
+func (lx *LXRHash) SetLogger(l Logger) {
+	lx.logger = l
+}
+
+// Verbose enables or disables the output of progress indicators to the console
+func (lx *LXRHash) Verbose(val bool) {
+	if val {
+		lx.logger = newConsoleLogger(os.Stdout)
+	} else {
+		lx.logger = nil
+	}
+}
+
+// Log is a wrapper function that only prints information when verbose is enabled, or a Logger is set
+func (lx *LXRHash) Log(msg string) {
+	lx.log(LevelInfo, msg)
+}
+
+// log sends an event to the Logger of lx, if it has one
+func (lx *LXRHash) log(level Level, msg string, kv ...interface{}) {
+	if lx.logger != nil {
+		lx.logger.Log(level, msg, kv...)
+	}
+}
@@ -0,0 +1,32 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+//go:build go1.21
+// +build go1.21
+
+package lxr
+
+import (
+	"context"
+	"log/slog"
+)
+
+// NewSlogLogger returns a Logger that sends events to l, with the key value pairs as attributes
+func NewSlogLogger(l *slog.Logger) Logger {
+	return LoggerFunc(func(level Level, msg string, kv ...interface{}) {
+		l.Log(context.Background(), slogLevel(level), msg, kv...)
+	})
+}
+
+// slogLevel maps a Level onto the matching slog.Level
+func slogLevel(level Level) slog.Level {
+	switch {
+	case level <= LevelDebug:
+		return slog.LevelDebug
+	case level == LevelInfo:
+		return slog.LevelInfo
+	case level == LevelWarn:
+		return slog.LevelWarn
+	}
+	return slog.LevelError
+}
@@ -0,0 +1,31 @@
+//go:build go1.21
+// +build go1.21
+
+package lxr
+
+import (
+	"bytes"
+	"log/slog"
+	"testing"
+)
+
+func TestNewSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	h := slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	})
+	l := NewSlogLogger(slog.New(h))
+
+	l.Log(LevelDebug, "hidden")
+	l.Log(LevelWarn, "Table is not valid", "path", "/tmp/table.dat")
+
+	want := "level=WARN msg=\"Table is not valid\" path=/tmp/table.dat\n"
+	if buf.String() != want {
+		t.Errorf("got = %q, want = %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,59 @@
+package lxr
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestNewStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), LevelInfo)
+
+	l.Log(LevelDebug, "hidden")
+	l.Log(LevelInfo, "Reading ByteMap Table", "path", "/tmp/table.dat", "pass", 3)
+	l.Log(LevelWarn, "odd", "key")
+
+	want := "INFO Reading ByteMap Table path=/tmp/table.dat pass=3\nWARN odd key\n"
+	if buf.String() != want {
+		t.Errorf("got = %q, want = %q", buf.String(), want)
+	}
+}
+
+func TestLXRHash_SetLogger(t *testing.T) {
+	type event struct {
+		level Level
+		msg   string
+		kv    []interface{}
+	}
+	var events []event
+
+	l, err := New(Options{Seed: Seed, MapSizeBits: 8, HashSize: HashSize, Passes: Passes, Logger: LoggerFunc(func(level Level, msg string, kv ...interface{}) {
+		events = append(events, event{level, msg, kv})
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) == 0 {
+		t.Fatal("no log events while loading a table")
+	}
+	if e := events[0]; e.msg != "Reading ByteMap Table" || len(e.kv) != 2 || e.kv[0] != "path" || !strings.HasSuffix(e.kv[1].(string), "size-8.dat") {
+		t.Errorf("unexpected first event %v", e)
+	}
+
+	events = nil
+	l.SetLogger(nil)
+	l.GenerateTable()
+	if len(events) != 0 {
+		t.Errorf("logged %d events after the logger was removed", len(events))
+	}
+}
+
+func TestInit_Silent(t *testing.T) {
+	one := Init(Seed, 8, HashSize, Passes)
+	defer Release(one)
+	if one.logger != nil {
+		t.Errorf("shared instances should be silent")
+	}
+}
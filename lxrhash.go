@@ -2,117 +2,230 @@
 // Licensed under the MIT License. See LICENSE file in the project root for full license information.
 package lxr
 
+import (
+	"sync"
+	"time"
+)
+
 // LXRHash holds one instance of a hash function with a specific seed and map size
 type LXRHash struct {
-	ByteMap     []byte // Integer Offsets
-	MapSize     uint64 // Size of the translation table
-	MapSizeBits uint64 // Size of the ByteMap in Bits
-	Passes      uint64 // Passes to generate the rand table
-	Seed        uint64 // An arbitrary number used to create the tables.
-	HashSize    uint64 // Number of bytes in the hash
-	verbose     bool
+	ByteMap         []byte // Integer Offsets
+	MapSize         uint64 // Size of the translation table
+	MapSizeBits     uint64 // Size of the ByteMap in Bits
+	Passes          uint64 // Passes to generate the rand table
+	Seed            uint64 // An arbitrary number used to create the tables.
+	HashSize        uint64 // Number of bytes in the hash
+	logger          Logger
+	loadMode        LoadMode
+	dir             string // Directory holding table files.  See TableDir
+	readOnly        bool   // Never generate or write the table
+	lockTimeout     time.Duration
+	progress        ProgressFunc
+	skipMemoryCheck bool
+	mapping         []byte // The mapped table file, when the ByteMap is memory mapped
 }
 
 // Hash takes the arbitrary input and returns the resulting hash of length HashSize
 func (lx LXRHash) Hash(src []byte) []byte {
-	// Keep the byte intermediate results as int64 values until reduced.
-	hs := make([]uint64, lx.HashSize)
-	// as accumulates the state as we walk through applying the source data through the lookup map
-	// and combine it with the state we are building up.
-	var as = lx.Seed
-	// We keep a series of states, and roll them along through each byte of source processed.
-	var s1, s2, s3 uint64
-	// Since MapSize is specified in bits, the index mask is the size-1
-	mk := lx.MapSize - 1
-
-	B := func(v uint64) uint64 { return uint64(lx.ByteMap[v&mk]) }
-	b := func(v uint64) byte { return byte(B(v)) }
-
-	faststep := func(v2 uint64, idx uint64) {
-		b := B(as ^ v2)
-		as = as<<7 ^ as>>5 ^ v2<<20 ^ v2<<16 ^ v2 ^ b<<20 ^ b<<12 ^ b<<4
-		s1 = s1<<9 ^ s1>>3 ^ hs[idx]
-		hs[idx] = s1 ^ as
-		s1, s2, s3 = s3, s1, s2
-	}
+	bytes := make([]byte, lx.HashSize)
+	lx.HashInto(bytes, src)
+
+	// Return the resulting hash
+	return bytes
+}
+
+// HashInto computes the same hash as Hash, writing it into dst, which must be at least HashSize bytes.
+// The working state comes from a pool, so once the pool is warm HashInto does not allocate.
+func (lx *LXRHash) HashInto(dst []byte, src []byte) {
+	st := statePool.Get().(*state)
+	st.init(lx)
+	st.hash(dst[:lx.HashSize], src)
+	statePool.Put(st)
+}
+
+// Scratch holds the working state for hashing, so a goroutine hashing in a loop can reuse it
+// rather than go through the pool used by HashInto.  A Scratch must not be used concurrently.
+type Scratch struct {
+	st state
+}
+
+// NewScratch returns a Scratch for hashing with lx
+func (lx *LXRHash) NewScratch() *Scratch {
+	s := new(Scratch)
+	s.st.init(lx)
+	return s
+}
+
+// HashInto computes the same hash as Hash, writing it into dst, which must be at least HashSize bytes.
+// It never allocates.
+func (s *Scratch) HashInto(dst []byte, src []byte) {
+	s.st.hash(dst[:s.st.hashSize], src)
+}
+
+// statePool holds states for HashInto.  Any state can be set up for any LXRHash by init, which
+// reuses its hs slice when it is large enough.
+var statePool = sync.Pool{New: func() interface{} { return new(state) }}
+
+// state holds the intermediate results of a hash in progress.  Everything that computes an LXRHash
+// drives a state, so all of them produce identical results.
+type state struct {
+	byteMap  []byte   // The ByteMap of the LXRHash being computed
+	mk       uint64   // Since MapSize is specified in bits, the index mask is the size-1
+	seed     uint64   // Starting value of as
+	hs       []uint64 // Keep the byte intermediate results as int64 values until reduced.
+	as       uint64   // as accumulates the state as we walk through applying the source data through the lookup map
+	s1       uint64   // We keep a series of states, and roll them along through each byte of source processed.
+	s2       uint64   //
+	s3       uint64   //
+	idx      uint64   // Index into hs of the next byte processed by fast or slow
+	hashSize uint64   // Number of bytes in the hash
+}
 
-	// Define a function to move the state by one byte.  This is not intended to be fast
-	// Requires the previous byte read to process the next byte read.  Forces serial evaluation
-	// and removes the possibility of scheduling byte access.
-	//
-	// (Note that use of _ = 0 in lines below are to keep go fmt from messing with comments on the right of the page)
-	step := func(v2 uint64, idx uint64) {
-		s1 = s1<<9 ^ s1>>1 ^ as ^ B(as>>5^v2)<<3      // Shifts are not random.  They are selected to ensure that
-		s1 = s1<<5 ^ s1>>3 ^ B(s1^v2)<<7              // Prior bytes pulled from the ByteMap contribute to the
-		s1 = s1<<7 ^ s1>>7 ^ B(as^s1>>7)<<5           // next access of the ByteMap, either by contributing to
-		s1 = s1<<11 ^ s1>>5 ^ B(v2^as>>11^s1)<<27     // the lower bits of the index, or in the upper bits that
-		_ = 0                                         // move the access further in the map.
-		hs[idx] = s1 ^ as ^ hs[idx]<<7 ^ hs[idx]>>13  //
-		_ = 0                                         // We also pay attention not only to where the ByteMap bits
-		as = as<<17 ^ as>>5 ^ s1 ^ B(as^s1>>27^v2)<<3 // are applied, but what bits we use in the indexing of
-		as = as<<13 ^ as>>3 ^ B(as^s1)<<7             // the ByteMap
-		as = as<<15 ^ as>>7 ^ B(as>>7^s1)<<11         //
-		as = as<<9 ^ as>>11 ^ B(v2^as^s1)<<3          // Tests run against this set of shifts show that the
-		_ = 0                                         // bytes pulled from the ByteMap are evenly distributed
-		s1 = s1<<7 ^ s1>>27 ^ as ^ B(as>>3)<<13       // over possible byte values (0-255) and indexes into
-		s1 = s1<<3 ^ s1>>13 ^ B(s1^v2)<<11            // the ByteMap are also evenly distributed, and the
-		s1 = s1<<8 ^ s1>>11 ^ B(as^s1>>11)<<9         // deltas between bytes provided map to a curve expected
-		s1 = s1<<6 ^ s1>>9 ^ B(v2^as^s1)<<3           // (fewer maximum and minimum deltas, and most deltas around
-		_ = 0                                         // zero.
-		as = as<<23 ^ as>>3 ^ s1 ^ B(as^v2^s1>>3)<<7
-		as = as<<17 ^ as>>7 ^ B(as^s1>>3)<<5
-		as = as<<13 ^ as>>5 ^ B(as>>5^s1)<<1
-		as = as<<11 ^ as>>1 ^ B(v2^as^s1)<<7
-
-		s1 = s1<<5 ^ s1>>3 ^ as ^ B(as>>7^s1>>3)<<6
-		s1 = s1<<8 ^ s1>>6 ^ B(s1^v2)<<11
-		s1 = s1<<11 ^ s1>>11 ^ B(as^s1>>11)<<5
-		s1 = s1<<7 ^ s1>>5 ^ B(v2^as>>7^as^s1)<<17
-
-		s2 = s2<<3 ^ s2>>17 ^ s1 ^ B(as^s2>>5^v2)<<13
-		s2 = s2<<6 ^ s2>>13 ^ B(s2)<<11
-		s2 = s2<<11 ^ s2>>11 ^ B(as^s1^s2>>11)<<23
-		s2 = s2<<4 ^ s2>>23 ^ B(v2^as>>8^as^s2>>10)<<1
-
-		s1 = s2<<3 ^ s2>>1 ^ hs[idx] ^ v2
-		as = as<<9 ^ as>>7 ^ s1>>1 ^ B(s2>>1^hs[idx])<<5
-
-		s1, s2, s3 = s3, s1, s2
+// init sets up the state to hash with the given LXRHash
+func (st *state) init(lx *LXRHash) {
+	st.byteMap = lx.ByteMap
+	st.mk = lx.MapSize - 1
+	st.seed = lx.Seed
+	st.hashSize = lx.HashSize
+	if uint64(cap(st.hs)) < lx.HashSize {
+		st.hs = make([]uint64, lx.HashSize)
 	}
+	st.hs = st.hs[:lx.HashSize]
+	st.reset()
+}
+
+// hash computes the hash of src into bytes, starting from a reset state
+func (st *state) hash(bytes []byte, src []byte) {
+	st.reset()
 
-	idx := uint64(0)
 	// Fast spin to prevent caching state
+	st.fast(src)
+
+	// Actual work to compute the hash
+	st.idx = 0
+	st.slow(src)
+
+	st.reduce(bytes)
+}
+
+// reset puts the state back to where it is before any source is processed
+func (st *state) reset() {
+	for i := range st.hs {
+		st.hs[i] = 0
+	}
+	st.as = st.seed
+	st.s1, st.s2, st.s3 = 0, 0, 0
+	st.idx = 0
+}
+
+// copyFrom makes st an independent copy of src, reusing the hs slice of st if it is large enough
+func (st *state) copyFrom(src *state) {
+	hs := st.hs
+	*st = *src
+	if cap(hs) < len(src.hs) {
+		hs = make([]uint64, len(src.hs))
+	}
+	st.hs = hs[:len(src.hs)]
+	copy(st.hs, src.hs)
+}
+
+// B looks up a value in the ByteMap
+func (st *state) B(v uint64) uint64 { return uint64(st.byteMap[v&st.mk]) }
+
+// fast runs the fast spin over src, continuing from st.idx
+func (st *state) fast(src []byte) {
+	idx := st.idx
 	for _, v2 := range src {
-		if idx >= lx.HashSize { // Use an if to avoid modulo math
+		if idx >= st.hashSize { // Use an if to avoid modulo math
 			idx = 0
 		}
-		faststep(uint64(v2), idx)
+		st.faststep(uint64(v2), idx)
 		idx++
 	}
+	st.idx = idx
+}
 
-	idx = 0
-	// Actual work to compute the hash
+// slow runs the actual work of the hash over src, continuing from st.idx
+func (st *state) slow(src []byte) {
+	idx := st.idx
 	for _, v2 := range src {
-		if idx >= lx.HashSize { // Use an if to avoid modulo math
+		if idx >= st.hashSize { // Use an if to avoid modulo math
 			idx = 0
 		}
-		step(uint64(v2), idx)
+		st.step(uint64(v2), idx)
 		idx++
 	}
+	st.idx = idx
+}
 
-	// Reduction pass
-	// Done by Interating over hs[] to produce the bytes[] hash
-	//
-	// At this point, we have HBits of state in hs.  We need to reduce them down to a byte,
-	// And we do so by doing a bit more bitwise math, and mapping the values through our byte map.
-
-	bytes := make([]byte, lx.HashSize)
+// reduce writes the HashSize bytes of the hash into bytes
+//
+// Done by Interating over hs[] to produce the bytes[] hash
+//
+// At this point, we have HBits of state in hs.  We need to reduce them down to a byte,
+// And we do so by doing a bit more bitwise math, and mapping the values through our byte map.
+func (st *state) reduce(bytes []byte) {
+	hs := st.hs
 	// Roll over all the hs (one int64 value for every byte in the resulting hash) and reduce them to byte values
 	for i := len(hs) - 1; i >= 0; i-- {
-		step(hs[i], uint64(i))      // Step the hash functions and then
-		bytes[i] = b(as) ^ b(hs[i]) // Xor two resulting sequences
+		st.step(hs[i], uint64(i))                        // Step the hash functions and then
+		bytes[i] = byte(st.B(st.as)) ^ byte(st.B(hs[i])) // Xor two resulting sequences
 	}
+}
 
-	// Return the resulting hash
-	return bytes
+func (st *state) faststep(v2 uint64, idx uint64) {
+	b := st.B(st.as ^ v2)
+	st.as = st.as<<7 ^ st.as>>5 ^ v2<<20 ^ v2<<16 ^ v2 ^ b<<20 ^ b<<12 ^ b<<4
+	st.s1 = st.s1<<9 ^ st.s1>>3 ^ st.hs[idx]
+	st.hs[idx] = st.s1 ^ st.as
+	st.s1, st.s2, st.s3 = st.s3, st.s1, st.s2
+}
+
+// Define a function to move the state by one byte.  This is not intended to be fast
+// Requires the previous byte read to process the next byte read.  Forces serial evaluation
+// and removes the possibility of scheduling byte access.
+//
+// (Note that use of _ = 0 in lines below are to keep go fmt from messing with comments on the right of the page)
+func (st *state) step(v2 uint64, idx uint64) {
+	byteMap, mk := st.byteMap, st.mk
+	B := func(v uint64) uint64 { return uint64(byteMap[v&mk]) }
+	as, s1, s2, s3 := st.as, st.s1, st.s2, st.s3
+	hs := st.hs
+
+	s1 = s1<<9 ^ s1>>1 ^ as ^ B(as>>5^v2)<<3      // Shifts are not random.  They are selected to ensure that
+	s1 = s1<<5 ^ s1>>3 ^ B(s1^v2)<<7              // Prior bytes pulled from the ByteMap contribute to the
+	s1 = s1<<7 ^ s1>>7 ^ B(as^s1>>7)<<5           // next access of the ByteMap, either by contributing to
+	s1 = s1<<11 ^ s1>>5 ^ B(v2^as>>11^s1)<<27     // the lower bits of the index, or in the upper bits that
+	_ = 0                                         // move the access further in the map.
+	hs[idx] = s1 ^ as ^ hs[idx]<<7 ^ hs[idx]>>13  //
+	_ = 0                                         // We also pay attention not only to where the ByteMap bits
+	as = as<<17 ^ as>>5 ^ s1 ^ B(as^s1>>27^v2)<<3 // are applied, but what bits we use in the indexing of
+	as = as<<13 ^ as>>3 ^ B(as^s1)<<7             // the ByteMap
+	as = as<<15 ^ as>>7 ^ B(as>>7^s1)<<11         //
+	as = as<<9 ^ as>>11 ^ B(v2^as^s1)<<3          // Tests run against this set of shifts show that the
+	_ = 0                                         // bytes pulled from the ByteMap are evenly distributed
+	s1 = s1<<7 ^ s1>>27 ^ as ^ B(as>>3)<<13       // over possible byte values (0-255) and indexes into
+	s1 = s1<<3 ^ s1>>13 ^ B(s1^v2)<<11            // the ByteMap are also evenly distributed, and the
+	s1 = s1<<8 ^ s1>>11 ^ B(as^s1>>11)<<9         // deltas between bytes provided map to a curve expected
+	s1 = s1<<6 ^ s1>>9 ^ B(v2^as^s1)<<3           // (fewer maximum and minimum deltas, and most deltas around
+	_ = 0                                         // zero.
+	as = as<<23 ^ as>>3 ^ s1 ^ B(as^v2^s1>>3)<<7
+	as = as<<17 ^ as>>7 ^ B(as^s1>>3)<<5
+	as = as<<13 ^ as>>5 ^ B(as>>5^s1)<<1
+	as = as<<11 ^ as>>1 ^ B(v2^as^s1)<<7
+
+	s1 = s1<<5 ^ s1>>3 ^ as ^ B(as>>7^s1>>3)<<6
+	s1 = s1<<8 ^ s1>>6 ^ B(s1^v2)<<11
+	s1 = s1<<11 ^ s1>>11 ^ B(as^s1>>11)<<5
+	s1 = s1<<7 ^ s1>>5 ^ B(v2^as>>7^as^s1)<<17
+
+	s2 = s2<<3 ^ s2>>17 ^ s1 ^ B(as^s2>>5^v2)<<13
+	s2 = s2<<6 ^ s2>>13 ^ B(s2)<<11
+	s2 = s2<<11 ^ s2>>11 ^ B(as^s1^s2>>11)<<23
+	s2 = s2<<4 ^ s2>>23 ^ B(v2^as>>8^as^s2>>10)<<1
+
+	s1 = s2<<3 ^ s2>>1 ^ hs[idx] ^ v2
+	as = as<<9 ^ as>>7 ^ s1>>1 ^ B(s2>>1^hs[idx])<<5
+
+	st.as, st.s1, st.s2, st.s3 = as, s3, s1, s2
 }
@@ -4,6 +4,7 @@ package lxr
 
 import (
 	"bytes"
+	"encoding/binary"
 	"encoding/hex"
 	"testing"
 )
@@ -41,6 +42,51 @@ func BenchmarkHash(b *testing.B) {
 	})
 }
 
+func BenchmarkHashInto(b *testing.B) {
+	src := append(append([]byte{}, oprhash...), 0, 0, 0, 0)
+	dst := make([]byte, lx.HashSize)
+	b.Run("pool", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			binary.LittleEndian.PutUint32(src[len(oprhash):], uint32(i))
+			lx.HashInto(dst, src)
+		}
+	})
+	b.Run("scratch", func(b *testing.B) {
+		b.ReportAllocs()
+		s := lx.NewScratch()
+		for i := 0; i < b.N; i++ {
+			binary.LittleEndian.PutUint32(src[len(oprhash):], uint32(i))
+			s.HashInto(dst, src)
+		}
+	})
+}
+
+func TestHashInto(t *testing.T) {
+	src := []byte("test string")
+	want := lx.Hash(src)
+
+	dst := make([]byte, lx.HashSize+1)
+	lx.HashInto(dst, src)
+	if !bytes.Equal(dst[:lx.HashSize], want) || dst[lx.HashSize] != 0 {
+		t.Errorf("HashInto mismatch. got = %x, want = %x", dst, want)
+	}
+	s := lx.NewScratch()
+	for i := 0; i < 2; i++ {
+		s.HashInto(dst, src)
+		if !bytes.Equal(dst[:lx.HashSize], want) {
+			t.Errorf("Scratch.HashInto mismatch. got = %x, want = %x", dst, want)
+		}
+	}
+
+	if n := testing.AllocsPerRun(100, func() { s.HashInto(dst, src) }); n != 0 {
+		t.Errorf("Scratch.HashInto allocated %.1f times per run", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { lx.HashInto(dst, src) }); n != 0 {
+		t.Errorf("HashInto allocated %.1f times per run", n)
+	}
+}
+
 func TestKnownHashes(t *testing.T) {
 
 	known := map[string]string{
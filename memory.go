@@ -0,0 +1,21 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import "fmt"
+
+// checkMemory returns ErrInsufficientMemory if the platform reports less available memory than the
+// ByteMap of lx needs.  A ByteMap that doesn't fit in RAM would swap on every hash, or get the process
+// killed, so it is better to fail before allocating it.  Platforms that don't report available memory
+// always pass.
+func (lx *LXRHash) checkMemory() error {
+	if lx.skipMemoryCheck {
+		return nil
+	}
+	avail, ok := availableMemory()
+	if !ok || lx.MapSize <= avail {
+		return nil
+	}
+	lx.log(LevelError, "Not enough memory for the ByteMap", "need", lx.MapSize, "available", avail)
+	return fmt.Errorf("%w: the ByteMap needs %d MiB, %d MiB available", ErrInsufficientMemory, lx.MapSize>>20, avail>>20)
+}
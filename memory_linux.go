@@ -0,0 +1,37 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+package lxr
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// availableMemory returns the memory available for new allocations, as MemAvailable in /proc/meminfo
+func availableMemory() (uint64, bool) {
+	f, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	return parseMeminfo(bufio.NewScanner(f))
+}
+
+// parseMeminfo finds the MemAvailable line, i.e. "MemAvailable:    5582684 kB", and returns it in bytes
+func parseMeminfo(s *bufio.Scanner) (uint64, bool) {
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 3 || fields[0] != "MemAvailable:" || fields[2] != "kB" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return kb << 10, true
+	}
+	return 0, false
+}
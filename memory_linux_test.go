@@ -0,0 +1,48 @@
+package lxr
+
+import (
+	"bufio"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseMeminfo(t *testing.T) {
+	meminfo := "MemTotal:        6158152 kB\nMemFree:          306120 kB\nMemAvailable:    5582684 kB\nBuffers:          145756 kB\n"
+	if got, ok := parseMeminfo(bufio.NewScanner(strings.NewReader(meminfo))); !ok || got != 5582684<<10 {
+		t.Errorf("parseMeminfo() = %d, %v, want %d, true", got, ok, 5582684<<10)
+	}
+	// Kernels before 3.14 don't report MemAvailable
+	if _, ok := parseMeminfo(bufio.NewScanner(strings.NewReader("MemTotal:        6158152 kB\n"))); ok {
+		t.Error("parseMeminfo() found MemAvailable that isn't there")
+	}
+	if _, ok := availableMemory(); !ok {
+		t.Error("availableMemory() could not read /proc/meminfo")
+	}
+}
+
+func TestLXRHash_checkMemory(t *testing.T) {
+	l := new(LXRHash)
+	l.MapSize = 1 << 20
+	if err := l.checkMemory(); err != nil {
+		t.Errorf("1 MiB ByteMap failed the memory check: %v", err)
+	}
+	l.MapSize = 1 << 60
+	if err := l.checkMemory(); !errors.Is(err, ErrInsufficientMemory) {
+		t.Errorf("expected ErrInsufficientMemory for an exabyte ByteMap, got %v", err)
+	}
+	l.skipMemoryCheck = true
+	if err := l.checkMemory(); err != nil {
+		t.Errorf("skipped memory check failed: %v", err)
+	}
+}
+
+func TestNew_InsufficientMemory(t *testing.T) {
+	p := Params{Seed: Seed, MapSizeBits: MaxMapSizeBits, HashSize: HashSize, Passes: Passes}
+	if avail, _ := availableMemory(); avail >= 1<<p.MapSizeBits {
+		t.Skip("enough memory for the largest ByteMap")
+	}
+	if _, err := NewParams(p, WithDir(t.TempDir())); !errors.Is(err, ErrInsufficientMemory) {
+		t.Errorf("expected ErrInsufficientMemory, got %v", err)
+	}
+}
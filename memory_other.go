@@ -0,0 +1,10 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+//go:build !linux
+// +build !linux
+
+package lxr
+
+// availableMemory is not known on this platform
+func availableMemory() (uint64, bool) { return 0, false }
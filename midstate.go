@@ -0,0 +1,94 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+// Mining hashes the same prefix (i.e. an OPR hash) with billions of different nonces, so it pays to
+// save the state of the hash after the prefix and continue from it for each nonce.
+//
+// Hash can't make much use of that.  Its second pass starts from the state left by the fast spin
+// over all of the source, nonce included, so only the fast spin over the prefix can be saved.  The
+// second pass, where nearly all the work is, has to be redone over the whole source every time.
+//
+// HashV2 is a variant of the hash that does the fast spin and the second pass together, a byte at
+// a time.  The state after the prefix is then all the state there is, and a Midstate made with
+// MidstateV2 skips all the work of the prefix.  HashV2 gives different hashes from Hash, so it is
+// only usable where everyone agrees to use it, i.e. as a new version of a PoW.
+
+// HashV2 takes the arbitrary input and returns the resulting hash of length HashSize, using version 2
+// of the hash, which allows a Midstate to skip a shared prefix entirely
+func (lx *LXRHash) HashV2(src []byte) []byte {
+	bytes := make([]byte, lx.HashSize)
+	lx.HashV2Into(bytes, src)
+	return bytes
+}
+
+// HashV2Into computes the same hash as HashV2, writing it into dst, which must be at least HashSize bytes
+func (lx *LXRHash) HashV2Into(dst []byte, src []byte) {
+	st := statePool.Get().(*state)
+	st.init(lx)
+	st.single(src)
+	st.reduce(dst[:lx.HashSize])
+	statePool.Put(st)
+}
+
+// single is the single pass over src of version 2 of the hash, continuing from st.idx
+func (st *state) single(src []byte) {
+	idx := st.idx
+	for _, v2 := range src {
+		if idx >= st.hashSize { // Use an if to avoid modulo math
+			idx = 0
+		}
+		st.faststep(uint64(v2), idx)
+		st.step(uint64(v2), idx)
+		idx++
+	}
+	st.idx = idx
+}
+
+// Midstate holds the state of a hash after a prefix, so hashes of the prefix followed by different
+// suffixes can be computed without redoing the work of the prefix.  A Midstate must not be used
+// concurrently; make one per goroutine.
+type Midstate struct {
+	v2     bool
+	prefix []byte // The prefix, which version 1 has to replay in its second pass
+	st     state  // State after the prefix
+	work   state  // State used to finish each hash
+}
+
+// Midstate returns a Midstate after prefix for Hash.  Only the fast spin over the prefix is saved.
+func (lx *LXRHash) Midstate(prefix []byte) *Midstate {
+	m := &Midstate{prefix: append([]byte{}, prefix...)}
+	m.st.init(lx)
+	m.st.fast(prefix)
+	return m
+}
+
+// MidstateV2 returns a Midstate after prefix for HashV2.  All the work of the prefix is saved.
+func (lx *LXRHash) MidstateV2(prefix []byte) *Midstate {
+	m := &Midstate{v2: true}
+	m.st.init(lx)
+	m.st.single(prefix)
+	return m
+}
+
+// Hash returns the hash of the prefix followed by suffix
+func (m *Midstate) Hash(suffix []byte) []byte {
+	bytes := make([]byte, m.st.hashSize)
+	m.HashInto(bytes, suffix)
+	return bytes
+}
+
+// HashInto computes the hash of the prefix followed by suffix into dst, which must be at least
+// HashSize bytes.  It does not allocate.
+func (m *Midstate) HashInto(dst []byte, suffix []byte) {
+	m.work.copyFrom(&m.st)
+	if m.v2 {
+		m.work.single(suffix)
+	} else {
+		m.work.fast(suffix)
+		m.work.idx = 0
+		m.work.slow(m.prefix)
+		m.work.slow(suffix)
+	}
+	m.work.reduce(dst[:m.st.hashSize])
+}
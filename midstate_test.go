@@ -0,0 +1,87 @@
+package lxr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"testing"
+)
+
+func TestMidstate(t *testing.T) {
+	l := new(LXRHash)
+	l.Init(Seed, 8, HashSize, Passes)
+
+	r := rand.New(rand.NewSource(1))
+	for _, size := range []int{0, 1, 31, 32, 33, 100, 1000} {
+		prefix := make([]byte, size)
+		r.Read(prefix)
+
+		m1 := l.Midstate(prefix)
+		m2 := l.MidstateV2(prefix)
+		for nonce := uint64(0); nonce < 300; nonce += 37 {
+			suffix := LittleEndianNonce(nil, nonce)
+			src := append(append([]byte{}, prefix...), suffix...)
+
+			if got, want := m1.Hash(suffix), l.Hash(src); !bytes.Equal(got, want) {
+				t.Errorf("[%d/%d] Midstate mismatch. got = %x, want = %x", size, nonce, got, want)
+			}
+			if got, want := m2.Hash(suffix), l.HashV2(src); !bytes.Equal(got, want) {
+				t.Errorf("[%d/%d] MidstateV2 mismatch. got = %x, want = %x", size, nonce, got, want)
+			}
+		}
+	}
+
+	dst := make([]byte, l.HashSize)
+	for _, m := range []*Midstate{l.Midstate(oprhash), l.MidstateV2(oprhash)} {
+		if n := testing.AllocsPerRun(100, func() { m.HashInto(dst, []byte{1, 2, 3}) }); n != 0 {
+			t.Errorf("Midstate.HashInto allocated %.1f times per run", n)
+		}
+	}
+}
+
+func TestHashV2(t *testing.T) {
+	l := new(LXRHash)
+	l.Init(Seed, 8, HashSize, Passes)
+
+	// Version 2 is a different hash, and must stay the same hash
+	src := []byte("test string")
+	if bytes.Equal(l.HashV2(src), l.Hash(src)) {
+		t.Error("HashV2 gives the same hash as Hash")
+	}
+	want, _ := hex.DecodeString("e3c3dc6525d76fe0fc0ac0a5be6091e5399e95fd477315041d185eb1550ab426")
+	if got := l.HashV2(src); !bytes.Equal(got, want) {
+		t.Errorf("HashV2 changed. got = %x, want = %x", got, want)
+	}
+
+	dst := make([]byte, l.HashSize)
+	if n := testing.AllocsPerRun(100, func() { l.HashV2Into(dst, src) }); n != 0 {
+		t.Errorf("HashV2Into allocated %.1f times per run", n)
+	}
+}
+
+func BenchmarkMidstate(b *testing.B) {
+	dst := make([]byte, lx.HashSize)
+	nonce := make([]byte, 8)
+	b.Run("v1", func(b *testing.B) {
+		m := lx.Midstate(oprhash)
+		for i := 0; i < b.N; i++ {
+			binary.LittleEndian.PutUint64(nonce, uint64(i))
+			m.HashInto(dst, nonce)
+		}
+	})
+	b.Run("v2 full", func(b *testing.B) {
+		src := append(append([]byte{}, oprhash...), nonce...)
+		for i := 0; i < b.N; i++ {
+			binary.LittleEndian.PutUint64(src[len(oprhash):], uint64(i))
+			lx.HashV2Into(dst, src)
+		}
+	})
+	b.Run("v2", func(b *testing.B) {
+		m := lx.MidstateV2(oprhash)
+		for i := 0; i < b.N; i++ {
+			binary.LittleEndian.PutUint64(nonce, uint64(i))
+			m.HashInto(dst, nonce)
+		}
+	})
+}
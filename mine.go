@@ -0,0 +1,198 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"context"
+	"encoding/binary"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// NonceEncoder appends the encoding of nonce to dst, which holds the base data being mined
+type NonceEncoder func(dst []byte, nonce uint64) []byte
+
+// LittleEndianNonce encodes a nonce in as few little endian bytes as it needs, so nonce 0 adds nothing
+func LittleEndianNonce(dst []byte, nonce uint64) []byte {
+	for ; nonce > 0; nonce = nonce >> 8 {
+		dst = append(dst, byte(nonce))
+	}
+	return dst
+}
+
+// NonceValue returns the nonce encoded by LittleEndianNonce in b.  Bytes past the 8th are shifted out.
+func NonceValue(b []byte) uint64 {
+	var nonce uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		nonce = nonce<<8 | uint64(b[i])
+	}
+	return nonce
+}
+
+// FixedNonce encodes a nonce as 8 little endian bytes
+func FixedNonce(dst []byte, nonce uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], nonce)
+	return append(dst, b[:]...)
+}
+
+// MineOptions controls the search done by Mine
+type MineOptions struct {
+	Hash     *LXRHash                // The hash to mine with
+	HashFunc func(src []byte) []byte // Used in place of Hash if Hash is nil, i.e. sha256 for comparisons
+	Workers  int                     // Number of goroutines searching.  Defaults to runtime.NumCPU()
+	Encode   NonceEncoder            // Appends the nonce to the base data.  Defaults to LittleEndianNonce
+	Target   uint64                  // Stop once a hash of at least this difficulty is found.  0 never stops
+	Start    uint64                  // First nonce to try
+	End      uint64                  // Stop once the nonces before End are tried.  0 never stops
+
+	// Nonces, if not nil, hands out the nonces to try in place of Start and End.  Each worker takes
+	// a range at a time and records its progress, so Nonces.Remaining is a checkpoint of the search.
+	Nonces *NonceAllocator
+
+	// Counts, if not nil, must have an entry for each worker.  Worker w atomically adds 1 to Counts[w]
+	// for every hash it makes, so the hash rate can be followed while Mine runs.
+	Counts []uint64
+
+	// OnBest is called every time a hash is found with a greater difficulty than any before it.
+	// Calls are never concurrent, and the arguments are only valid for the duration of the call.
+	OnBest func(nonce []byte, hash []byte, difficulty uint64)
+
+	// OnShare, if not nil, is called for every hash with a difficulty of at least Share, i.e. for
+	// submitting shares to a pool.  Calls are never concurrent with each other or with OnBest, and the
+	// arguments are only valid for the duration of the call.
+	OnShare func(nonce []byte, hash []byte, difficulty uint64)
+	Share   uint64
+}
+
+// Mine searches for the nonce that, appended to base, gives the hash with the greatest difficulty.
+// The search stops when a hash meets opts.Target, or when ctx is done, and returns the best nonce
+// found, its hash, and the hash's difficulty.
+//
+// Worker w of n tries the nonces Start+w, Start+w+n, Start+w+2n, ... so no two workers hash the same
+// data.  With an End, Mine also returns once all the nonces from Start to End are tried.  With Nonces,
+// each worker tries the ranges it takes from Nonces in order, and Mine returns once Nonces has no more.
+func Mine(ctx context.Context, base []byte, opts MineOptions) (nonce []byte, hash []byte, difficulty uint64) {
+	if opts.Hash == nil && opts.HashFunc == nil {
+		panic("lxr: Mine needs a Hash or a HashFunc")
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	encode := opts.Encode
+	if encode == nil {
+		encode = LittleEndianNonce
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mtx sync.Mutex
+	share := func(data, h []byte, d uint64) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		opts.OnShare(data[len(base):], h, d)
+	}
+	found := false
+	best := func(data, h []byte, d uint64) bool {
+		mtx.Lock()
+		defer mtx.Unlock()
+		if d > difficulty || !found {
+			found = true
+			difficulty = d
+			nonce = append(nonce[:0], data[len(base):]...)
+			hash = append(hash[:0], h...)
+			if opts.OnBest != nil {
+				opts.OnBest(nonce, hash, difficulty)
+			}
+		}
+		return opts.Target != 0 && difficulty >= opts.Target
+	}
+
+	if opts.Counts != nil && len(opts.Counts) < workers {
+		panic("lxr: Mine needs a count for each worker")
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			data := append(make([]byte, 0, len(base)+16), base...)
+			var h []byte
+			var s *Scratch
+			if opts.Hash != nil {
+				s = opts.Hash.NewScratch()
+				h = make([]byte, opts.Hash.HashSize)
+			}
+
+			var count *uint64
+			if opts.Counts != nil {
+				count = &opts.Counts[w]
+			}
+
+			n, step, start, end := opts.Start+uint64(w), uint64(workers), opts.Start, opts.End
+			var r NonceRange
+			if opts.Nonces != nil {
+				var ok bool
+				if r, ok = opts.Nonces.Next(); !ok {
+					return
+				}
+				n, step, start, end = r.Start, 1, r.Start, r.End
+				defer func() { opts.Nonces.Release(r, n) }()
+			}
+
+			var mine uint64
+			first := true
+			for i := 0; ; i++ {
+				if i&0xFF == 0 {
+					if ctx.Err() != nil {
+						return
+					}
+					if opts.Nonces != nil {
+						opts.Nonces.Progress(r, n)
+					}
+				}
+				if end != 0 && (n >= end || n < start) { // n < start if n wrapped
+					if opts.Nonces == nil {
+						return
+					}
+					opts.Nonces.Progress(r, end)
+					next, ok := opts.Nonces.Next()
+					if !ok {
+						return // r is done, so releasing it does nothing, but it must stay r
+					}
+					r = next
+					n, start, end = r.Start, r.Start, r.End
+				}
+				data = encode(data[:len(base)], n)
+				if s != nil {
+					s.HashInto(h, data)
+				} else {
+					h = opts.HashFunc(data)
+				}
+				if count != nil {
+					atomic.AddUint64(count, 1)
+				}
+				d := Difficulty(h)
+				if opts.OnShare != nil && d >= opts.Share {
+					share(data, h, d)
+				}
+				if d > mine || first {
+					mine, first = d, false
+					if best(data, h, d) {
+						cancel()
+						n++ // n is covered
+						return
+					}
+				}
+				n += step
+			}
+		}(w)
+	}
+	wg.Wait()
+	return
+}
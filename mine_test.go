@@ -0,0 +1,192 @@
+package lxr
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMine(t *testing.T) {
+	l := new(LXRHash)
+	l.Init(Seed, 8, HashSize, Passes)
+	base := []byte("000000000200000000020000000002000")
+
+	var calls int
+	var last uint64
+	target := uint64(0xFFF0000000000000)
+	nonce, hash, diff := Mine(context.Background(), base, MineOptions{
+		Hash:    l,
+		Workers: 4,
+		Target:  target,
+		OnBest: func(nonce []byte, hash []byte, difficulty uint64) {
+			if calls > 0 && difficulty <= last {
+				t.Errorf("best went from %x to %x", last, difficulty)
+			}
+			calls++
+			last = difficulty
+		},
+	})
+
+	if diff < target {
+		t.Errorf("difficulty %x does not meet the target %x", diff, target)
+	}
+	if diff != last || calls == 0 {
+		t.Errorf("OnBest was not called with the result")
+	}
+	want := l.Hash(append(append([]byte{}, base...), nonce...))
+	if !bytes.Equal(hash, want) {
+		t.Errorf("hash does not match nonce %x. got = %x, want = %x", nonce, hash, want)
+	}
+	if Difficulty(want) != diff {
+		t.Errorf("wrong difficulty %x for %x", diff, want)
+	}
+}
+
+func TestMine_Context(t *testing.T) {
+	base := []byte("foo")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var hashes uint64
+	counts := make([]uint64, 2)
+	start := time.Now()
+	nonce, hash, diff := Mine(ctx, base, MineOptions{
+		HashFunc: func(src []byte) []byte { atomic.AddUint64(&hashes, 1); h := sha256.Sum256(src); return h[:] },
+		Workers:  2,
+		Encode:   FixedNonce,
+		Counts:   counts,
+	})
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("mining did not stop with the context")
+	}
+	if counts[0] == 0 || counts[1] == 0 || counts[0]+counts[1] != hashes {
+		t.Errorf("counts %d do not add up to the %d hashes made", counts, hashes)
+	}
+	if len(nonce) != 8 {
+		t.Errorf("expected an 8 byte nonce, got %x", nonce)
+	}
+	want := sha256.Sum256(append(append([]byte{}, base...), nonce...))
+	if !bytes.Equal(hash, want[:]) || Difficulty(hash) != diff {
+		t.Errorf("result does not match nonce %x", nonce)
+	}
+}
+
+func TestLittleEndianNonce(t *testing.T) {
+	for n, want := range map[uint64][]byte{0: {}, 1: {1}, 0x100: {0, 1}, 0x123456: {0x56, 0x34, 0x12}} {
+		if got := LittleEndianNonce([]byte{}, n); !bytes.Equal(got, want) {
+			t.Errorf("%x encoded as %x, want = %x", n, got, want)
+		}
+	}
+}
+
+func TestNonceValue(t *testing.T) {
+	for _, n := range []uint64{0, 1, 0xff, 0x100, 0x123456789abcdef0} {
+		if got := NonceValue(LittleEndianNonce(nil, n)); got != n {
+			t.Errorf("NonceValue() = %x, want %x", got, n)
+		}
+	}
+}
+
+func TestMine_Range(t *testing.T) {
+	seen := make(map[uint64]int)
+	counts := make([]uint64, 3)
+	nonce, _, _ := Mine(context.Background(), []byte("foo"), MineOptions{
+		HashFunc: func(src []byte) []byte { h := sha256.Sum256(src); return h[:] },
+		Workers:  3,
+		Start:    1000,
+		End:      1100,
+		Counts:   counts,
+		OnShare: func(nonce []byte, hash []byte, difficulty uint64) {
+			seen[NonceValue(nonce)]++
+		},
+	})
+	if len(seen) != 100 || counts[0]+counts[1]+counts[2] != 100 {
+		t.Errorf("hashed %d nonces, %d times, expected 100", len(seen), counts[0]+counts[1]+counts[2])
+	}
+	for n := uint64(1000); n < 1100; n++ {
+		if seen[n] != 1 {
+			t.Errorf("nonce %d hashed %d times", n, seen[n])
+		}
+	}
+	if len(nonce) != 2 {
+		t.Errorf("best nonce %x is outside the range", nonce)
+	}
+}
+
+func TestMine_Nonces(t *testing.T) {
+	seen := make(map[uint64]int)
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := MineOptions{
+		HashFunc: func(src []byte) []byte { h := sha256.Sum256(src); return h[:] },
+		Workers:  3,
+		Nonces:   NewNonceAllocator(100, NonceRange{1000, 6000}),
+		OnShare: func(nonce []byte, hash []byte, difficulty uint64) {
+			if seen[NonceValue(nonce)]++; len(seen) == 2000 {
+				cancel()
+			}
+		},
+	}
+
+	// Stop part way, then resume from a checkpoint
+	Mine(ctx, []byte("foo"), opts)
+	remaining := opts.Nonces.Remaining()
+	var left uint64
+	for _, r := range remaining {
+		left += r.Len()
+	}
+	if left+uint64(len(seen)) != 5000 {
+		t.Errorf("%d nonces hashed but %d remain", len(seen), left)
+	}
+	opts.Nonces = NewNonceAllocator(100, remaining...)
+	Mine(context.Background(), []byte("foo"), opts)
+
+	if len(seen) != 5000 {
+		t.Errorf("hashed %d nonces, expected 5000", len(seen))
+	}
+	for n := uint64(1000); n < 6000; n++ {
+		if seen[n] != 1 {
+			t.Errorf("nonce %d hashed %d times", n, seen[n])
+		}
+	}
+	if r := opts.Nonces.Remaining(); len(r) != 0 {
+		t.Errorf("nonces %v remain", r)
+	}
+}
+
+func TestMine_NoncesFinishApart(t *testing.T) {
+	// The worker with the range that starts at 0 is slow, so the other runs out of nonces first.  Its
+	// range must still be recorded as in progress, not lost when the other worker stops.
+	nonces := NewNonceAllocator(1000, NonceRange{0, 2000})
+	counts := make([]uint64, 2)
+	var remaining []NonceRange
+	Mine(context.Background(), []byte("foo"), MineOptions{
+		HashFunc: func(src []byte) []byte {
+			n := NonceValue(src[3:])
+			if n < 1000 {
+				time.Sleep(10 * time.Microsecond)
+			}
+			if n == 900 {
+				for atomic.LoadUint64(&counts[0])+atomic.LoadUint64(&counts[1]) < 1900 {
+					time.Sleep(time.Millisecond)
+				}
+				time.Sleep(20 * time.Millisecond) // For the fast worker to stop
+				remaining = nonces.Remaining()
+			}
+			h := sha256.Sum256(src)
+			return h[:]
+		},
+		Workers: 2,
+		Counts:  counts,
+		Nonces:  nonces,
+	})
+
+	if len(remaining) != 1 || remaining[0].Start > 900 || remaining[0].End != 1000 {
+		t.Errorf("Remaining() = %v part way through the range at 0", remaining)
+	}
+	if r := nonces.Remaining(); len(r) != 0 {
+		t.Errorf("nonces %v remain once Mine is done", r)
+	}
+}
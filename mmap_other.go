@@ -0,0 +1,17 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package lxr
+
+// mmapFile is not supported on this platform.  Tables are read into memory instead.
+func mmapFile(filename string) ([]byte, error) {
+	return nil, errNoMmap
+}
+
+// munmap is not supported on this platform
+func munmap(b []byte) error {
+	return errNoMmap
+}
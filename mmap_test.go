@@ -0,0 +1,33 @@
+package lxr
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNew_LoadMmap(t *testing.T) {
+	want := new(LXRHash)
+	want.Init(Seed, 12, HashSize, Passes)
+
+	l, err := New(Options{Seed: Seed, MapSizeBits: 12, HashSize: HashSize, Passes: Passes, LoadMode: LoadMmap})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, want.ByteMap) {
+		t.Errorf("mapped ByteMap differs from the table read into memory")
+	}
+	buf := []byte("test string")
+	if !bytes.Equal(l.Hash(buf), want.Hash(buf)) {
+		t.Errorf("mapped and read tables provided different hash results")
+	}
+
+	if err := l.Close(); err != nil {
+		t.Error(err)
+	}
+	if l.mapping != nil {
+		t.Errorf("mapping not released on close")
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("second close failed: %v", err)
+	}
+}
@@ -0,0 +1,38 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package lxr
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// mmapFile maps the whole of filename into memory, read only and shared, so every process that maps
+// the same table uses the same pages of the page cache.
+func mmapFile(filename string) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	if size <= 0 || int64(int(size)) != size {
+		return nil, fmt.Errorf("cannot map %s of %d bytes", filename, size)
+	}
+	return syscall.Mmap(int(f.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmap releases a mapping made by mmapFile
+func munmap(b []byte) error {
+	return syscall.Munmap(b)
+}
@@ -0,0 +1,188 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"math"
+	"sort"
+	"sync"
+)
+
+// NonceRange is the nonces from Start up to but not including End
+type NonceRange struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// AllNonces is the whole space of nonces, but for the last one
+var AllNonces = NonceRange{0, math.MaxUint64}
+
+// Len returns the number of nonces in r
+func (r NonceRange) Len() uint64 {
+	if r.End < r.Start {
+		return 0
+	}
+	return r.End - r.Start
+}
+
+// Contains returns true if nonce is in r
+func (r NonceRange) Contains(nonce uint64) bool {
+	return nonce >= r.Start && nonce < r.End
+}
+
+// Split divides r into n disjoint ranges whose lengths differ by at most one, i.e. for n machines to
+// search.  Split of AllNonces into a power of 2 parts gives the same ranges as PrefixNonces.
+func (r NonceRange) Split(n int) []NonceRange {
+	if n < 1 {
+		panic("lxr: can't split nonces into fewer than one part")
+	}
+	size, extra := r.Len()/uint64(n), r.Len()%uint64(n)
+	parts := make([]NonceRange, n)
+	start := r.Start
+	for i := range parts {
+		end := start + size
+		if uint64(i) < extra {
+			end++
+		}
+		parts[i] = NonceRange{start, end}
+		start = end
+	}
+	return parts
+}
+
+// PrefixNonces returns the nonces whose top bits are prefix, so up to 1<<bits machines can each take
+// a prefix of their own.  The last prefix leaves out the last nonce, as AllNonces does.
+func PrefixNonces(prefix uint64, bits uint) NonceRange {
+	if bits < 1 || bits > 63 || prefix>>bits != 0 {
+		panic("lxr: nonce prefix must fit in 1 to 63 bits")
+	}
+	shift := 64 - bits
+	r := NonceRange{prefix << shift, (prefix + 1) << shift}
+	if r.End == 0 {
+		r.End = math.MaxUint64
+	}
+	return r
+}
+
+// NonceAllocator hands out disjoint ranges of nonces, and keeps track of which nonces have been
+// covered, so a search can be checkpointed and resumed without hashing any nonce twice.  Its methods
+// are safe for concurrent use.
+//
+// A worker calls Next for a range, calls Progress as it works through the range in order, and calls
+// Release if it stops before the end.  What Release gives back is handed out again.
+type NonceAllocator struct {
+	mtx  sync.Mutex
+	size uint64
+	free []NonceRange           // Nonces not handed out, in order
+	out  map[uint64]*NonceRange // Uncovered nonces of the ranges handed out, by the start of the range
+}
+
+// NewNonceAllocator returns a NonceAllocator that hands out the nonces of ranges, size nonces at a
+// time.  To resume a search, pass the ranges Remaining returned.
+func NewNonceAllocator(size uint64, ranges ...NonceRange) *NonceAllocator {
+	if size == 0 {
+		panic("lxr: nonce ranges must hold at least one nonce")
+	}
+	a := &NonceAllocator{size: size, out: make(map[uint64]*NonceRange)}
+	for _, r := range ranges {
+		a.free = addRange(a.free, r)
+	}
+	return a
+}
+
+// addRange adds r to the sorted ranges, merging it with the ranges it touches
+func addRange(ranges []NonceRange, r NonceRange) []NonceRange {
+	if r.Len() == 0 {
+		return ranges
+	}
+	i := sort.Search(len(ranges), func(i int) bool { return ranges[i].End >= r.Start })
+	j := i
+	for j < len(ranges) && ranges[j].Start <= r.End {
+		if ranges[j].Start < r.Start {
+			r.Start = ranges[j].Start
+		}
+		if ranges[j].End > r.End {
+			r.End = ranges[j].End
+		}
+		j++
+	}
+	return append(append(append([]NonceRange{}, ranges[:i]...), r), ranges[j:]...)
+}
+
+// Next hands out the next range of nonces.  It returns false once every nonce has been handed out.
+func (a *NonceAllocator) Next() (NonceRange, bool) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if len(a.free) == 0 {
+		return NonceRange{}, false
+	}
+	r := a.free[0]
+	if r.Len() > a.size {
+		r.End = r.Start + a.size
+		a.free[0].Start = r.End
+	} else {
+		a.free = a.free[1:]
+	}
+	left := r
+	a.out[r.Start] = &left
+	return r, true
+}
+
+// Progress records that the nonces of r before next have been covered.  Once next reaches r.End, r
+// is done.
+func (a *NonceAllocator) Progress(r NonceRange, next uint64) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	a.progress(r, next)
+}
+
+func (a *NonceAllocator) progress(r NonceRange, next uint64) *NonceRange {
+	left := a.out[r.Start]
+	if left == nil {
+		return nil
+	}
+	if next > left.Start {
+		left.Start = next
+	}
+	if left.Start >= left.End {
+		delete(a.out, r.Start)
+		return nil
+	}
+	return left
+}
+
+// Release records that the nonces of r before next have been covered, and gives back the rest of r
+// to be handed out again
+func (a *NonceAllocator) Release(r NonceRange, next uint64) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	if left := a.progress(r, next); left != nil {
+		delete(a.out, r.Start)
+		a.free = addRange(a.free, *left)
+	}
+}
+
+// Remaining returns the nonces not yet covered, whether handed out or not, in order.  It is a
+// checkpoint of the search: a NonceAllocator made from it hands out exactly those nonces.
+func (a *NonceAllocator) Remaining() []NonceRange {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	remaining := append([]NonceRange{}, a.free...)
+	for _, left := range a.out {
+		remaining = addRange(remaining, *left)
+	}
+	return remaining
+}
+
+// Ranges returns the nonces not yet covered, as Remaining does, but split into those of the ranges
+// handed out and not yet done or released, and those not handed out.  While Mine runs, the ranges
+// handed out are the ones the workers are in, starting at the next nonce each will try.
+func (a *NonceAllocator) Ranges() (inProgress, unallocated []NonceRange) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	for _, left := range a.out {
+		inProgress = append(inProgress, *left)
+	}
+	sort.Slice(inProgress, func(i, j int) bool { return inProgress[i].Start < inProgress[j].Start })
+	return inProgress, append([]NonceRange{}, a.free...)
+}
@@ -0,0 +1,96 @@
+package lxr
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestNonceRange_Split(t *testing.T) {
+	parts := NonceRange{10, 21}.Split(3)
+	want := []NonceRange{{10, 14}, {14, 18}, {18, 21}}
+	if !reflect.DeepEqual(parts, want) {
+		t.Errorf("Split() = %v, want %v", parts, want)
+	}
+	parts = AllNonces.Split(7)
+	var total uint64
+	for i, p := range parts {
+		if i > 0 && p.Start != parts[i-1].End {
+			t.Errorf("part %d %v does not follow %v", i, p, parts[i-1])
+		}
+		total += p.Len()
+	}
+	if total != AllNonces.Len() || parts[6].End != AllNonces.End {
+		t.Errorf("parts cover %d nonces, ending at %x", total, parts[6].End)
+	}
+
+	// Splitting all the nonces in a power of 2 parts gives the prefixes
+	for i, p := range AllNonces.Split(4) {
+		if p != PrefixNonces(uint64(i), 2) {
+			t.Errorf("part %d is %v, prefix is %v", i, p, PrefixNonces(uint64(i), 2))
+		}
+	}
+}
+
+func TestPrefixNonces(t *testing.T) {
+	if r := PrefixNonces(1, 2); r != (NonceRange{1 << 62, 1 << 63}) {
+		t.Errorf("PrefixNonces(1, 2) = %v", r)
+	}
+	if r := PrefixNonces(3, 2); r != (NonceRange{3 << 62, math.MaxUint64}) {
+		t.Errorf("PrefixNonces(3, 2) = %v", r)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("a prefix too big for its bits was accepted")
+		}
+	}()
+	PrefixNonces(4, 2)
+}
+
+func TestNonceAllocator(t *testing.T) {
+	a := NewNonceAllocator(10, NonceRange{50, 75}, NonceRange{0, 20}, NonceRange{20, 25})
+
+	var got []NonceRange
+	for {
+		r, ok := a.Next()
+		if !ok {
+			break
+		}
+		got = append(got, r)
+	}
+	want := []NonceRange{{0, 10}, {10, 20}, {20, 25}, {50, 60}, {60, 70}, {70, 75}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Next() gave %v, want %v", got, want)
+	}
+
+	a.Progress(got[0], 10)  // Done
+	a.Progress(got[1], 15)  // Part way
+	a.Release(got[3], 55)   // Given back
+	a.Release(got[4], 60)   // Given back untouched
+	a.Progress(got[5], 100) // Done
+	want = []NonceRange{{15, 25}, {55, 70}}
+	if r := a.Remaining(); !reflect.DeepEqual(r, want) {
+		t.Errorf("Remaining() = %v, want %v", r, want)
+	}
+	inProgress, unallocated := a.Ranges()
+	if !reflect.DeepEqual(inProgress, []NonceRange{{15, 20}, {20, 25}}) || !reflect.DeepEqual(unallocated, []NonceRange{{55, 70}}) {
+		t.Errorf("Ranges() = %v, %v", inProgress, unallocated)
+	}
+
+	// Ranges given back are handed out again
+	if r, ok := a.Next(); !ok || r != (NonceRange{55, 65}) {
+		t.Errorf("Next() = %v, %v after Release", r, ok)
+	}
+
+	// A checkpoint resumes with just the nonces left
+	b := NewNonceAllocator(100, a.Remaining()...)
+	if r, ok := b.Next(); !ok || r != (NonceRange{15, 25}) {
+		t.Errorf("resumed Next() = %v, %v", r, ok)
+	}
+	if r, ok := b.Next(); !ok || r != (NonceRange{55, 70}) {
+		t.Errorf("resumed Next() = %v, %v", r, ok)
+	}
+	if _, ok := b.Next(); ok {
+		t.Error("resumed allocator handed out too much")
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"context"
+	"time"
+)
+
+// LoadMode selects how the ByteMap is loaded from its table file
+type LoadMode int
+
+const (
+	LoadRead LoadMode = iota // Read the table into memory owned by this process
+	LoadMmap                 // Map the table read only and shared, so processes on a host share one copy
+)
+
+// ProgressFunc is called as a table is generated.  pass counts from 0 to passes-1, and done counts
+// the indexes of the ByteMap shuffled so far in this pass, out of total.
+type ProgressFunc func(pass, passes int, done, total uint64)
+
+// Options holds the parameters used to construct an LXRHash with New
+type Options struct {
+	Seed        uint64        // An arbitrary number used to create the tables
+	MapSizeBits uint64        // Number of bits in the ByteMap index, i.e. 10 = mapsize of 1024
+	HashSize    uint64        // Number of bits in the hash; truncated to a byte boundary
+	Passes      uint64        // Number of shuffles of the ByteMap
+	Verbose     bool          // Print progress indicators to the console
+	Logger      Logger        // Receives log events.  Takes the place of Verbose when set
+	LoadMode    LoadMode      // How the table is loaded.  Defaults to LoadRead
+	Dir         string        // Directory holding table files.  See TableDir for the default
+	ReadOnly    bool          // Fail rather than generate and write a missing or invalid table
+	LockTimeout time.Duration // How long to wait on another process generating the table.  Defaults to DefaultLockTimeout
+	Progress    ProgressFunc  // Called as the table is generated, if it has to be
+
+	// SkipMemoryCheck allocates the ByteMap even when the platform reports less available memory than
+	// it needs, i.e. where the report is wrong, or when swapping is acceptable
+	SkipMemoryCheck bool
+}
+
+// Params returns the parameters of the LXRHash described by o
+func (o Options) Params() Params {
+	return Params{Seed: o.Seed, MapSizeBits: o.MapSizeBits, HashSize: o.HashSize, Passes: o.Passes}
+}
+
+// Option sets one of the Options that don't change the hash, for use with NewParams and Params.Options
+type Option func(*Options)
+
+// WithDir sets the directory holding table files
+func WithDir(dir string) Option { return func(o *Options) { o.Dir = dir } }
+
+// WithLogger sets the Logger that receives log events
+func WithLogger(l Logger) Option { return func(o *Options) { o.Logger = l } }
+
+// WithLoadMode sets how the table is loaded
+func WithLoadMode(mode LoadMode) Option { return func(o *Options) { o.LoadMode = mode } }
+
+// WithVerbose prints progress indicators to the console
+func WithVerbose(val bool) Option { return func(o *Options) { o.Verbose = val } }
+
+// WithReadOnly fails rather than generating and writing a missing or invalid table
+func WithReadOnly(val bool) Option { return func(o *Options) { o.ReadOnly = val } }
+
+// WithLockTimeout sets how long to wait on another process generating the table
+func WithLockTimeout(d time.Duration) Option { return func(o *Options) { o.LockTimeout = d } }
+
+// WithProgress sets the function called as the table is generated
+func WithProgress(fn ProgressFunc) Option { return func(o *Options) { o.Progress = fn } }
+
+// WithSkipMemoryCheck allocates the ByteMap even when the platform reports too little available memory
+func WithSkipMemoryCheck(val bool) Option { return func(o *Options) { o.SkipMemoryCheck = val } }
+
+// NewParams creates an LXRHash with the parameters p, modified by opts.  It is New(p.Options(opts...)).
+func NewParams(p Params, opts ...Option) (*LXRHash, error) {
+	return New(p.Options(opts...))
+}
+
+// New creates an LXRHash, loading its ByteMap from disk or generating it as needed.
+// Unlike Init, New reports failures as errors rather than panics.
+//
+// With LoadMmap, the LXRHash must be closed with Close when it is no longer used.
+func New(opts Options) (*LXRHash, error) {
+	return NewContext(context.Background(), opts)
+}
+
+// NewContext is New with a context that stops the generation of the table, or waiting on another
+// process generating it, when it is done.
+func NewContext(ctx context.Context, opts Options) (*LXRHash, error) {
+	lx := new(LXRHash)
+	lx.Verbose(opts.Verbose)
+	if opts.Logger != nil {
+		lx.SetLogger(opts.Logger)
+	}
+	lx.loadMode = opts.LoadMode
+	lx.dir = opts.Dir
+	lx.readOnly = opts.ReadOnly
+	lx.lockTimeout = opts.LockTimeout
+	lx.progress = opts.Progress
+	lx.skipMemoryCheck = opts.SkipMemoryCheck
+	if err := lx.init(ctx, opts.Params()); err != nil {
+		return nil, err
+	}
+	return lx, nil
+}
@@ -0,0 +1,52 @@
+package lxr
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	if _, err := New(Options{Seed: Seed, MapSizeBits: 7, HashSize: HashSize, Passes: Passes}); !errors.Is(err, ErrBadMapSize) {
+		t.Errorf("expected ErrBadMapSize for 7 bits, got %v", err)
+	}
+
+	l, err := New(Options{Seed: Seed, MapSizeBits: 8, HashSize: HashSize, Passes: Passes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := new(LXRHash)
+	old.Init(Seed, 8, HashSize, Passes)
+
+	buf := []byte("test string")
+	if !bytes.Equal(l.Hash(buf), old.Hash(buf)) {
+		t.Errorf("New and Init provided different hash results")
+	}
+}
+
+func TestNewShared(t *testing.T) {
+	if _, err := NewShared(Options{Seed: Seed, MapSizeBits: 0, HashSize: HashSize, Passes: Passes}); !errors.Is(err, ErrBadMapSize) {
+		t.Errorf("expected ErrBadMapSize for 0 bits, got %v", err)
+	}
+
+	one, err := NewShared(Options{Seed: Seed, MapSizeBits: 8, HashSize: HashSize, Passes: Passes})
+	if err != nil {
+		t.Fatal(err)
+	}
+	two := Init(Seed, 8, HashSize, Passes)
+	if one != two {
+		t.Errorf("NewShared and Init provided different instances")
+	}
+	Release(one)
+	Release(two)
+}
+
+func TestLXRHash_writeTableError(t *testing.T) {
+	l := new(LXRHash)
+	l.ByteMap = make([]byte, 256)
+	err := l.writeTable(filepath.Join(t.Name(), "missing", "table.dat"))
+	if !errors.Is(err, ErrTableIO) {
+		t.Errorf("expected ErrTableIO writing to a missing directory, got %v", err)
+	}
+}
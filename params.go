@@ -0,0 +1,63 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import "fmt"
+
+// Params are the parameters that define an LXRHash.  The same data hashed with different Params gives
+// unrelated hashes, so a hash means nothing without the Params it was made with.
+type Params struct {
+	Seed        uint64 // An arbitrary number used to create the tables
+	MapSizeBits uint64 // Number of bits in the ByteMap index, i.e. 10 = mapsize of 1024
+	HashSize    uint64 // Number of bits in the hash; truncated to a byte boundary
+	Passes      uint64 // Number of shuffles of the ByteMap
+}
+
+// Limits on the Params of an LXRHash.  A ByteMap of MaxMapSizeBits is 16 GiB.
+const (
+	MinMapSizeBits = 8
+	MaxMapSizeBits = 34
+	MinHashSize    = 8    // bits
+	MaxHashSize    = 4096 // bits
+)
+
+// DefaultParams are the parameters of the LXRHash used for PoW
+var DefaultParams = Params{Seed: Seed, MapSizeBits: MapSizeBits, HashSize: HashSize, Passes: Passes}
+
+// Params returns the parameters of lx
+func (lx *LXRHash) Params() Params {
+	return Params{Seed: lx.Seed, MapSizeBits: lx.MapSizeBits, HashSize: lx.HashSize * 8, Passes: lx.Passes}
+}
+
+// Validate returns an error if an LXRHash cannot be made with p
+func (p Params) Validate() error {
+	if p.MapSizeBits < MinMapSizeBits || p.MapSizeBits > MaxMapSizeBits {
+		return fmt.Errorf("%w: must be between %d and %d bits, was %d", ErrBadMapSize, MinMapSizeBits, MaxMapSizeBits, p.MapSizeBits)
+	}
+	if p.HashSize < MinHashSize || p.HashSize > MaxHashSize {
+		return fmt.Errorf("%w: must be between %d and %d bits, was %d", ErrBadHashSize, MinHashSize, MaxHashSize, p.HashSize)
+	}
+	return nil
+}
+
+// ID returns a string that identifies p.  Params that give the same hashes have the same ID, so
+// HashSize is rounded up to a whole number of bytes, as the LXRHash uses it.
+func (p Params) ID() string {
+	p = p.canonical()
+	return fmt.Sprintf("seed-%x-passes-%d-size-%d-hash-%d", p.Seed, p.Passes, p.MapSizeBits, p.HashSize)
+}
+
+// canonical returns p with HashSize rounded up to a whole number of bytes, as the LXRHash uses it
+func (p Params) canonical() Params {
+	p.HashSize = (p.HashSize + 7) / 8 * 8
+	return p
+}
+
+// Options returns Options for an LXRHash with the parameters p, modified by opts
+func (p Params) Options(opts ...Option) Options {
+	o := Options{Seed: p.Seed, MapSizeBits: p.MapSizeBits, HashSize: p.HashSize, Passes: p.Passes}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
@@ -0,0 +1,99 @@
+package lxr
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParams_ID(t *testing.T) {
+	p := DefaultParams
+	if got, want := p.ID(), "seed-fafaececfafaecec-passes-5-size-30-hash-256"; got != want {
+		t.Errorf("ID() = %s, want %s", got, want)
+	}
+
+	// HashSizes that round to the same number of bytes give the same hash
+	q := p
+	q.HashSize = 249
+	if p.ID() != q.ID() {
+		t.Errorf("HashSize 249 and 256 have different IDs: %s and %s", q.ID(), p.ID())
+	}
+
+	for _, q := range []Params{
+		{Seed: p.Seed + 1, MapSizeBits: p.MapSizeBits, HashSize: p.HashSize, Passes: p.Passes},
+		{Seed: p.Seed, MapSizeBits: p.MapSizeBits + 1, HashSize: p.HashSize, Passes: p.Passes},
+		{Seed: p.Seed, MapSizeBits: p.MapSizeBits, HashSize: p.HashSize + 8, Passes: p.Passes},
+		{Seed: p.Seed, MapSizeBits: p.MapSizeBits, HashSize: p.HashSize, Passes: p.Passes + 1},
+	} {
+		if p.ID() == q.ID() {
+			t.Errorf("%+v has the same ID as %+v", q, p)
+		}
+	}
+}
+
+func TestParams_Validate(t *testing.T) {
+	p := DefaultParams
+	if err := p.Validate(); err != nil {
+		t.Errorf("DefaultParams are invalid: %v", err)
+	}
+	for _, bits := range []uint64{0, 7, 35, 64, 1 << 63} {
+		p := DefaultParams
+		p.MapSizeBits = bits
+		if err := p.Validate(); !errors.Is(err, ErrBadMapSize) {
+			t.Errorf("expected ErrBadMapSize for %d bits, got %v", bits, err)
+		}
+	}
+	for _, size := range []uint64{0, 7, 4097, 1 << 63} {
+		p := DefaultParams
+		p.HashSize = size
+		if err := p.Validate(); !errors.Is(err, ErrBadHashSize) {
+			t.Errorf("expected ErrBadHashSize for %d bits, got %v", size, err)
+		}
+	}
+	for _, p := range []Params{
+		{MapSizeBits: MinMapSizeBits, HashSize: MinHashSize},
+		{MapSizeBits: MaxMapSizeBits, HashSize: MaxHashSize},
+	} {
+		if err := p.Validate(); err != nil {
+			t.Errorf("%+v is invalid: %v", p, err)
+		}
+	}
+}
+
+func TestNewParams(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrparams")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := Params{Seed: Seed, MapSizeBits: 8, HashSize: HashSize, Passes: Passes}
+	logged := false
+	l, err := NewParams(p, WithDir(dir), WithLoadMode(LoadMmap), WithLogger(LoggerFunc(func(Level, string, ...interface{}) {
+		logged = true
+	})))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if l.Params() != p {
+		t.Errorf("Params() = %+v, want %+v", l.Params(), p)
+	}
+	if l.dir != dir || l.loadMode != LoadMmap || !logged {
+		t.Errorf("options not applied: dir %q, load mode %d, logged %v", l.dir, l.loadMode, logged)
+	}
+
+	old := new(LXRHash)
+	old.Init(Seed, 8, HashSize, Passes)
+	buf := []byte("test string")
+	if !bytes.Equal(l.Hash(buf), old.Hash(buf)) {
+		t.Errorf("NewParams and Init provided different hash results")
+	}
+
+	if _, err := NewParams(Params{Seed: Seed, MapSizeBits: 4, HashSize: HashSize, Passes: Passes}); !errors.Is(err, ErrBadMapSize) {
+		t.Errorf("expected ErrBadMapSize for 4 bits, got %v", err)
+	}
+}
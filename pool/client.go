@@ -0,0 +1,317 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+package pool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	lxr "github.com/pegnet/LXRHash"
+)
+
+// ErrClientClosed is returned by the calls of a Client once its connection is closed
+var ErrClientClosed = errors.New("pool: client closed")
+
+// Client is a connection to a Server.  Its methods are safe for concurrent use.
+type Client struct {
+	nc      net.Conn
+	worker  string
+	session string
+	params  lxr.Params
+
+	wmu sync.Mutex
+	enc *json.Encoder
+
+	mtx     sync.Mutex
+	nextID  uint64
+	pending map[uint64]chan message
+	err     error // Why the connection closed
+
+	jobs chan Job
+	done chan struct{}
+}
+
+// Dial connects to the Server at the TCP address addr, and subscribes as worker
+func Dial(ctx context.Context, addr, worker string) (*Client, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		nc:      nc,
+		worker:  worker,
+		enc:     json.NewEncoder(nc),
+		pending: make(map[uint64]chan message),
+		jobs:    make(chan Job, 1),
+		done:    make(chan struct{}),
+	}
+	go c.read()
+
+	var r subscribeResult
+	if err := c.call(ctx, MethodSubscribe, subscribeParams{Worker: worker}, &r); err != nil {
+		c.Close()
+		return nil, err
+	}
+	c.session = r.Session
+	c.params = r.Params.params()
+	return c, nil
+}
+
+// Params returns the parameters of the LXRHash the Server verifies shares with
+func (c *Client) Params() lxr.Params { return c.params }
+
+// Session returns the ID the Server gave this connection
+func (c *Client) Session() string { return c.session }
+
+// Jobs returns the jobs the Server sends when it has new work.  Only the latest job is kept until it
+// is received.
+func (c *Client) Jobs() <-chan Job { return c.jobs }
+
+// Done returns a channel that is closed when the connection is closed
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+// Err returns why the connection closed, once Done is closed
+func (c *Client) Err() error {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	return c.err
+}
+
+// Close closes the connection to the Server
+func (c *Client) Close() error {
+	return c.nc.Close()
+}
+
+// GetJob asks the Server for a job, having finished the job with the ID done, or none if done is
+// empty.  The Server only hands out a new job once the client has finished the one it was given;
+// until then it gives that one again.
+func (c *Client) GetJob(ctx context.Context, done string) (Job, error) {
+	var j Job
+	err := c.call(ctx, MethodGetJob, getJobParams{Done: done}, &j)
+	return j, err
+}
+
+// Submit submits a nonce for a job.  It returns nil if the Server accepted the share, and an *Error
+// if the Server rejected it.
+func (c *Client) Submit(ctx context.Context, jobID string, nonce []byte) error {
+	var ok bool
+	return c.call(ctx, MethodSubmit, submitParams{JobID: jobID, Nonce: nonce}, &ok)
+}
+
+// call sends a request, and waits for its response
+func (c *Client) call(ctx context.Context, method string, params, result interface{}) error {
+	p, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	ch := make(chan message, 1)
+	c.mtx.Lock()
+	if c.err != nil {
+		c.mtx.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = ch
+	c.mtx.Unlock()
+	defer func() {
+		c.mtx.Lock()
+		delete(c.pending, id)
+		c.mtx.Unlock()
+	}()
+
+	c.wmu.Lock()
+	err = c.enc.Encode(message{JSONRPC: "2.0", ID: json.RawMessage(strconv.FormatUint(id, 10)), Method: method, Params: p})
+	c.wmu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	select {
+	case m := <-ch:
+		if m.Error != nil {
+			return m.Error
+		}
+		return json.Unmarshal(m.Result, result)
+	case <-c.done:
+		return c.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// read dispatches the messages from the Server until the connection closes
+func (c *Client) read() {
+	dec := json.NewDecoder(c.nc)
+	var err error
+	for {
+		var m message
+		if err = dec.Decode(&m); err != nil {
+			break
+		}
+		if m.ID == nil {
+			if m.Method == MethodNotify {
+				var j Job
+				if json.Unmarshal(m.Params, &j) == nil {
+					c.push(j)
+				}
+			}
+			continue
+		}
+		id, perr := strconv.ParseUint(string(m.ID), 10, 64)
+		c.mtx.Lock()
+		ch := c.pending[id]
+		c.mtx.Unlock()
+		if perr == nil && ch != nil {
+			ch <- m
+		}
+	}
+
+	c.mtx.Lock()
+	c.err = fmt.Errorf("%w: %v", ErrClientClosed, err)
+	c.mtx.Unlock()
+	c.nc.Close()
+	close(c.done)
+}
+
+// push queues a job from the Server, replacing any job not yet received
+func (c *Client) push(j Job) {
+	for {
+		select {
+		case c.jobs <- j:
+			return
+		default:
+		}
+		select {
+		case <-c.jobs:
+		default:
+		}
+	}
+}
+
+// Work hashes the jobs of the Server with lx until ctx is done or the connection closes, and submits
+// the shares it finds.  lx must have the Params of the Server.  opts sets the workers, counts, and
+// OnBest of the search, for each job; Work sets the rest.  submitted, if not nil, is called with
+// each share submitted and the Server's verdict, from a goroutine of its own.
+func (c *Client) Work(ctx context.Context, lx *lxr.LXRHash, opts lxr.MineOptions, submitted func(Share, error)) error {
+	if lx.Params().ID() != c.params.ID() {
+		return fmt.Errorf("pool: hash is %s, the server uses %s", lx.Params().ID(), c.params.ID())
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Shares are submitted in the background, so the workers don't wait on the Server.  Shares still
+	// queued when a clean job arrives are dropped, as the Server has dropped their jobs.  The Server
+	// also drops a job once it hands out the next, so a finished job's shares are flushed first.
+	type queued struct {
+		Share
+		clean   uint64        // Clean jobs received before the share was found
+		flushed chan struct{} // If not nil, closed once the shares queued before it are submitted
+	}
+	shares := make(chan queued, 256)
+	var clean uint64
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for s := range shares {
+			if s.flushed != nil {
+				close(s.flushed)
+				continue
+			}
+			if s.clean != atomic.LoadUint64(&clean) {
+				continue
+			}
+			err := c.Submit(ctx, s.JobID, s.Nonce)
+			if submitted != nil {
+				submitted(s.Share, err)
+			}
+		}
+	}()
+	defer func() {
+		close(shares)
+		wg.Wait()
+	}()
+
+	job, err := c.GetJob(ctx, "")
+	for {
+		if err != nil {
+			return err
+		}
+		o := opts
+		o.Hash, o.HashFunc, o.Encode = lx, nil, lxr.LittleEndianNonce
+		o.Start, o.End, o.Target = job.Start, job.End, 0
+		o.Share = job.Target
+		id, gen := job.ID, atomic.LoadUint64(&clean)
+		o.OnShare = func(nonce, hash []byte, difficulty uint64) {
+			s := Share{Worker: c.worker, JobID: id, Nonce: append([]byte{}, nonce...), Hash: append([]byte{}, hash...), Difficulty: difficulty}
+			select {
+			case shares <- queued{Share: s, clean: gen}:
+			case <-ctx.Done():
+			}
+		}
+
+		jctx, jcancel := context.WithCancel(ctx)
+		mined := make(chan struct{})
+		go func(data []byte) {
+			lxr.Mine(jctx, data, o)
+			close(mined)
+		}(job.Data)
+
+		var next *Job
+	wait:
+		for {
+			select {
+			case <-mined:
+				break wait
+			case j := <-c.jobs:
+				if j.ID == id {
+					continue // The job being worked, which GetJob got first as the two crossed
+				}
+				if j.Clean {
+					atomic.AddUint64(&clean, 1)
+					jcancel()
+					<-mined
+					next = &j
+					break wait
+				}
+				next = &j
+			case <-c.done:
+				jcancel()
+				<-mined
+				return c.Err()
+			case <-ctx.Done():
+				jcancel()
+				<-mined
+				return ctx.Err()
+			}
+		}
+		jcancel()
+
+		if next != nil {
+			job, err = *next, nil
+			continue
+		}
+		flushed := make(chan struct{})
+		select {
+		case shares <- queued{flushed: flushed}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		job, err = c.GetJob(ctx, job.ID)
+	}
+}
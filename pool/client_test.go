@@ -0,0 +1,112 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	lxr "github.com/pegnet/LXRHash"
+)
+
+func TestClient_Work(t *testing.T) {
+	lx := newTestHash(t)
+	var mtx sync.Mutex
+	accepted := make(map[string]int) // Shares by job
+	s, addr := startServer(t, lx, ServerOptions{RangeSize: 64, Target: testTarget, OnShare: func(s Share) {
+		mtx.Lock()
+		accepted[s.JobID]++
+		mtx.Unlock()
+	}})
+	s.SetWork([]byte("first"))
+
+	c, err := Dial(context.Background(), addr, "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var submitted, rejected int
+	switched := false // Once set, shares for the first data may be stale
+	done := make(chan error)
+	go func() {
+		done <- c.Work(ctx, lx, lxr.MineOptions{Workers: 2}, func(sh Share, err error) {
+			mtx.Lock()
+			defer mtx.Unlock()
+			submitted++
+			if err != nil && err != context.Canceled {
+				rejected++
+				if !switched || code(err) != CodeJobNotFound {
+					t.Errorf("share %x for job %s rejected: %v", sh.Nonce, sh.JobID, err)
+				}
+			}
+			if submitted == 20 {
+				switched = true
+				s.SetWork([]byte("second"))
+			}
+			if submitted == 40 {
+				cancel()
+			}
+		})
+	}()
+
+	select {
+	case err := <-done:
+		if err != context.Canceled {
+			t.Errorf("Work returned %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		cancel()
+		t.Fatal("Work did not find enough shares")
+	}
+
+	mtx.Lock()
+	defer mtx.Unlock()
+	if len(accepted) < 2 {
+		t.Errorf("shares for %d jobs, expected the client to work through several", len(accepted))
+	}
+	total := 0
+	for _, n := range accepted {
+		total += n
+	}
+	if total+rejected < 40 {
+		t.Errorf("%d shares accepted and %d rejected of %d submitted", total, rejected, submitted)
+	}
+}
+
+func TestClient_WrongParams(t *testing.T) {
+	_, addr := startServer(t, newTestHash(t), ServerOptions{})
+	c, err := Dial(context.Background(), addr, "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	other, err := lxr.NewParams(lxr.Params{Seed: lxr.Seed, MapSizeBits: 9, HashSize: lxr.HashSize, Passes: lxr.Passes}, lxr.WithDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Work(context.Background(), other, lxr.MineOptions{}, nil); err == nil {
+		t.Error("worked with a hash the server doesn't use")
+	}
+}
+
+func TestClient_ServerClosed(t *testing.T) {
+	s, addr := startServer(t, newTestHash(t), ServerOptions{})
+	c, err := Dial(context.Background(), addr, "worker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	s.Close()
+
+	select {
+	case <-c.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("client did not see the server close")
+	}
+	if _, err := c.GetJob(context.Background(), ""); err == nil {
+		t.Error("GetJob worked after the server closed")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+// Package pool implements a lightweight, stratum like protocol for pooling LXRHash miners.
+//
+// A Server hands out jobs: base data, a range of nonces to append to it, and the difficulty a hash
+// must have to count as a share.  Clients hash the nonces of their jobs, and submit every nonce that
+// gives a share.  The server verifies each share by hashing it again.
+//
+// Messages are JSON-RPC 2.0 objects, one per line, over TCP.  Nonces are little endian in as few bytes
+// as they need, as lxr.LittleEndianNonce encodes them.  Byte strings are hex, and 64 bit numbers are
+// decimal strings, so clients in any language can handle them.
+//
+//	mining.subscribe  client to server  {"worker": name}                 result {"session": id, "params": table}
+//	mining.getjob     client to server  {"done": id}                     result job
+//	mining.submit     client to server  {"job_id": id, "nonce": hex}     result true
+//	mining.notify     server to client  job, as a notification, when the server has new data
+//
+// A job is {"job_id", "data", "nonce_start", "nonce_end", "target", "clean"}, where the nonces to try
+// are nonce_start up to but not including nonce_end.  A clean job replaces any job being worked.
+// A client works one job at a time, and asks for the next with the ID of the one it has finished, which
+// the server then counts as searched.  If that is not the job the server last gave the client, as when
+// a clean job crosses the request, the server sends the client's job again rather than a new one.
+// The table parameters are {"seed", "bits", "hashsize", "passes"}, and a client must use them.
+package pool
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	lxr "github.com/pegnet/LXRHash"
+)
+
+// The methods of the protocol
+const (
+	MethodSubscribe = "mining.subscribe"
+	MethodGetJob    = "mining.getjob"
+	MethodSubmit    = "mining.submit"
+	MethodNotify    = "mining.notify"
+)
+
+// Error codes.  The negative codes are JSON-RPC's, and the rest follow stratum.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeOther          = 20
+	CodeJobNotFound    = 21
+	CodeDuplicateShare = 22
+	CodeLowDifficulty  = 23
+	CodeNotSubscribed  = 25
+	CodeNonceOutOfJob  = 26
+)
+
+// Error is an error sent by the other end of a connection
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("pool: %s (%d)", e.Message, e.Code)
+}
+
+// HexBytes is a byte string that is hex in JSON
+type HexBytes []byte
+
+// MarshalJSON encodes b as a hex string
+func (b HexBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(hex.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes a hex string into b
+func (b *HexBytes) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	d, err := hex.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	*b = d
+	return nil
+}
+
+// Job is a piece of work handed out by a Server
+type Job struct {
+	ID     string   `json:"job_id"`
+	Data   HexBytes `json:"data"`               // Base data the nonces are appended to
+	Start  uint64   `json:"nonce_start,string"` // First nonce of the job
+	End    uint64   `json:"nonce_end,string"`   // Nonces before this one are in the job
+	Target uint64   `json:"target,string"`      // Difficulty of a share
+	Clean  bool     `json:"clean"`              // Abandon any job being worked for this one
+}
+
+// Share is a share accepted by a Server, or submitted by a Client
+type Share struct {
+	Worker     string
+	JobID      string
+	Nonce      []byte
+	Hash       []byte
+	Difficulty uint64
+}
+
+// message is any JSON-RPC message: a request, a response, or a notification
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// tableParams are the lxr.Params of a pool on the wire
+type tableParams struct {
+	Seed        uint64 `json:"seed,string"`
+	MapSizeBits uint64 `json:"bits"`
+	HashSize    uint64 `json:"hashsize"`
+	Passes      uint64 `json:"passes"`
+}
+
+func toWire(p lxr.Params) tableParams {
+	return tableParams{Seed: p.Seed, MapSizeBits: p.MapSizeBits, HashSize: p.HashSize, Passes: p.Passes}
+}
+
+func (p tableParams) params() lxr.Params {
+	return lxr.Params{Seed: p.Seed, MapSizeBits: p.MapSizeBits, HashSize: p.HashSize, Passes: p.Passes}
+}
+
+type subscribeParams struct {
+	Worker string `json:"worker"`
+}
+
+type subscribeResult struct {
+	Session string      `json:"session"`
+	Params  tableParams `json:"params"`
+}
+
+type getJobParams struct {
+	Done string `json:"done,omitempty"` // The job finished
+}
+
+type submitParams struct {
+	JobID string   `json:"job_id"`
+	Nonce HexBytes `json:"nonce"`
+}
@@ -0,0 +1,409 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+
+package pool
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+
+	lxr "github.com/pegnet/LXRHash"
+)
+
+// DefaultRangeSize is the number of nonces in a job, if ServerOptions doesn't say otherwise
+const DefaultRangeSize = 1 << 16
+
+// ErrServerClosed is returned by Serve once Close is called
+var ErrServerClosed = errors.New("pool: server closed")
+
+// ServerOptions controls the jobs a Server hands out
+type ServerOptions struct {
+	RangeSize uint64         // Nonces in each job.  Defaults to DefaultRangeSize
+	Nonces    lxr.NonceRange // Nonces handed out for each work, i.e. a part of them for each pool.  Defaults to lxr.AllNonces
+	Target    uint64         // Difficulty of a share
+	Logger    lxr.Logger     // Receives log events
+
+	// OnShare is called for every share accepted.  Calls may be concurrent.
+	OnShare func(Share)
+}
+
+// Server hands out jobs to Clients, and verifies the shares they submit
+type Server struct {
+	hash *lxr.LXRHash
+	opts ServerOptions
+
+	mtx       sync.Mutex
+	data      []byte              // Base data of the current work
+	nonces    *lxr.NonceAllocator // Hands out the nonces of the current work
+	shares    map[uint64]struct{} // Nonces accepted as shares for the current work
+	seq       uint64              // Number of jobs handed out, for job IDs
+	sessions  uint64              // Number of sessions started, for session IDs
+	jobs      map[string]*job
+	conns     map[*conn]struct{}
+	listeners map[net.Listener]struct{}
+	closed    bool
+}
+
+// job is a Job handed out, and the client it was handed to
+type job struct {
+	Job
+	c *conn
+}
+
+// NewServer returns a Server that verifies shares with hash
+func NewServer(hash *lxr.LXRHash, opts ServerOptions) *Server {
+	if opts.RangeSize == 0 {
+		opts.RangeSize = DefaultRangeSize
+	}
+	if opts.Nonces == (lxr.NonceRange{}) {
+		opts.Nonces = lxr.AllNonces
+	}
+	return &Server{
+		hash:      hash,
+		opts:      opts,
+		jobs:      make(map[string]*job),
+		conns:     make(map[*conn]struct{}),
+		listeners: make(map[net.Listener]struct{}),
+	}
+}
+
+func (s *Server) log(level lxr.Level, msg string, kv ...interface{}) {
+	if s.opts.Logger != nil {
+		s.opts.Logger.Log(level, msg, kv...)
+	}
+}
+
+// SetWork replaces the base data that jobs are handed out for.  Jobs for the old data are dropped,
+// so shares for them are rejected, and every subscribed client is sent a clean job for the new data.
+func (s *Server) SetWork(data []byte) {
+	s.mtx.Lock()
+	s.data = append([]byte{}, data...)
+	s.nonces = lxr.NewNonceAllocator(s.opts.RangeSize, s.opts.Nonces)
+	s.shares = make(map[uint64]struct{})
+	s.jobs = make(map[string]*job)
+	notify := make(map[*conn]Job)
+	for c := range s.conns {
+		c.job = nil // Its nonces belong to the old work
+	}
+	for c := range s.conns {
+		if c.subscribed {
+			j, ok := s.newJob(c)
+			if !ok {
+				break
+			}
+			j.Clean = true
+			notify[c] = j
+		}
+	}
+	s.mtx.Unlock()
+
+	s.log(lxr.LevelInfo, "New work", "data", fmt.Sprintf("%x", data))
+	for c, j := range notify {
+		c.notify(MethodNotify, j)
+	}
+}
+
+// nextJob answers c's request for a job, having finished the job done.  If done is the job c has, its
+// nonces are covered, and c is handed a new job.  Otherwise c hasn't finished its job, or hasn't yet
+// received it, as with a clean job sent by SetWork as the request was on its way, and it gets its job
+// again.  It returns false if every nonce has been handed out.  s.mtx must be held.
+func (s *Server) nextJob(c *conn, done string) (Job, bool) {
+	if j := c.job; j != nil {
+		if j.ID != done {
+			return j.Job, true
+		}
+		s.nonces.Progress(lxr.NonceRange{Start: j.Start, End: j.End}, j.End)
+		delete(s.jobs, j.ID)
+		c.job = nil
+	}
+	return s.newJob(c)
+}
+
+// newJob hands out the next range of nonces for the current work to c, which has no job.  It returns
+// false if every nonce has been handed out.  s.mtx must be held.
+func (s *Server) newJob(c *conn) (Job, bool) {
+	r, ok := s.nonces.Next()
+	if !ok {
+		return Job{}, false
+	}
+	s.seq++
+	j := &job{
+		Job: Job{
+			ID:     strconv.FormatUint(s.seq, 16),
+			Data:   s.data,
+			Start:  r.Start,
+			End:    r.End,
+			Target: s.opts.Target,
+		},
+		c: c,
+	}
+	s.jobs[j.ID] = j
+	c.job = j
+	return j.Job, true
+}
+
+// release gives back the nonces of the job c was working, as c has gone away, to be handed out to
+// other clients.  Nothing is known of how far c got, so the whole job is given back.  s.mtx must be held.
+func (s *Server) release(c *conn) {
+	if j := c.job; j != nil {
+		s.nonces.Release(lxr.NonceRange{Start: j.Start, End: j.End}, j.Start)
+		delete(s.jobs, j.ID)
+		c.job = nil
+	}
+}
+
+// ListenAndServe listens on the TCP address addr, and serves clients until Close is called
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts clients on l until Close is called, when it returns ErrServerClosed
+func (s *Server) Serve(l net.Listener) error {
+	s.mtx.Lock()
+	if s.closed {
+		s.mtx.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mtx.Unlock()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			s.mtx.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mtx.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			return err
+		}
+		c := &conn{s: s, nc: nc, enc: json.NewEncoder(nc)}
+		s.mtx.Lock()
+		if s.closed {
+			s.mtx.Unlock()
+			nc.Close()
+			continue
+		}
+		s.conns[c] = struct{}{}
+		s.mtx.Unlock()
+		go c.serve()
+	}
+}
+
+// Addrs returns the addresses the Server is listening on
+func (s *Server) Addrs() []net.Addr {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	var addrs []net.Addr
+	for l := range s.listeners {
+		addrs = append(addrs, l.Addr())
+	}
+	return addrs
+}
+
+// Close stops the Server listening, and closes the connections of all its clients
+func (s *Server) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		if lerr := l.Close(); err == nil {
+			err = lerr
+		}
+	}
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	return err
+}
+
+// conn is the connection of a client to a Server
+type conn struct {
+	s   *Server
+	nc  net.Conn
+	wmu sync.Mutex
+	enc *json.Encoder
+
+	// Only used by the goroutine running serve, except subscribed and job, which are guarded by s.mtx
+	worker     string
+	session    string
+	subscribed bool
+	job        *job // The job being worked, the last handed out
+}
+
+// send writes a message to the client
+func (c *conn) send(m message) {
+	m.JSONRPC = "2.0"
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if err := c.enc.Encode(m); err != nil {
+		c.nc.Close()
+	}
+}
+
+// notify sends a notification to the client
+func (c *conn) notify(method string, params interface{}) {
+	p, _ := json.Marshal(params)
+	c.send(message{Method: method, Params: p})
+}
+
+// serve reads and answers requests until the client goes away
+func (c *conn) serve() {
+	defer func() {
+		c.s.mtx.Lock()
+		delete(c.s.conns, c)
+		c.s.release(c)
+		c.s.mtx.Unlock()
+		c.nc.Close()
+	}()
+	c.s.log(lxr.LevelDebug, "Client connected", "addr", c.nc.RemoteAddr())
+
+	dec := json.NewDecoder(c.nc)
+	for {
+		var m message
+		if err := dec.Decode(&m); err != nil {
+			if _, ok := err.(*json.SyntaxError); ok {
+				c.send(message{Error: &Error{CodeParseError, err.Error()}})
+			}
+			c.s.log(lxr.LevelDebug, "Client disconnected", "addr", c.nc.RemoteAddr(), "worker", c.worker, "error", err)
+			return
+		}
+		if m.Method == "" || m.ID == nil {
+			c.send(message{ID: m.ID, Error: &Error{CodeInvalidRequest, "not a request"}})
+			continue
+		}
+		result, err := c.handle(m.Method, m.Params)
+		if err != nil {
+			e, ok := err.(*Error)
+			if !ok {
+				e = &Error{CodeOther, err.Error()}
+			}
+			c.send(message{ID: m.ID, Error: e})
+			continue
+		}
+		r, _ := json.Marshal(result)
+		c.send(message{ID: m.ID, Result: r})
+	}
+}
+
+// handle runs a request, returning its result
+func (c *conn) handle(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case MethodSubscribe:
+		var p subscribeParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		c.s.mtx.Lock()
+		c.s.sessions++
+		c.session = strconv.FormatUint(c.s.sessions, 16)
+		c.subscribed = true
+		c.s.mtx.Unlock()
+		c.worker = p.Worker
+		c.s.log(lxr.LevelInfo, "Worker subscribed", "worker", c.worker, "session", c.session, "addr", c.nc.RemoteAddr())
+		return subscribeResult{Session: c.session, Params: toWire(c.s.hash.Params())}, nil
+
+	case MethodGetJob:
+		var p getJobParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		c.s.mtx.Lock()
+		defer c.s.mtx.Unlock()
+		if !c.subscribed {
+			return nil, &Error{CodeNotSubscribed, "not subscribed"}
+		}
+		if c.s.data == nil {
+			return nil, &Error{CodeOther, "no work"}
+		}
+		j, ok := c.s.nextJob(c, p.Done)
+		if !ok {
+			return nil, &Error{CodeOther, "no nonces left"}
+		}
+		return j, nil
+
+	case MethodSubmit:
+		var p submitParams
+		if err := unmarshalParams(params, &p); err != nil {
+			return nil, err
+		}
+		share, err := c.s.verify(c, p.JobID, p.Nonce)
+		if err != nil {
+			c.s.log(lxr.LevelDebug, "Share rejected", "worker", c.worker, "job", p.JobID, "nonce", fmt.Sprintf("%x", []byte(p.Nonce)), "error", err)
+			return nil, err
+		}
+		c.s.log(lxr.LevelDebug, "Share accepted", "worker", c.worker, "job", p.JobID, "nonce", fmt.Sprintf("%x", share.Nonce), "difficulty", fmt.Sprintf("%x", share.Difficulty))
+		if c.s.opts.OnShare != nil {
+			c.s.opts.OnShare(share)
+		}
+		return true, nil
+	}
+	return nil, &Error{CodeMethodNotFound, "unknown method " + method}
+}
+
+// unmarshalParams decodes the params of a request into v
+func unmarshalParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &Error{CodeInvalidParams, err.Error()}
+	}
+	return nil
+}
+
+// verify checks a nonce submitted for a job, and returns the share if it is one
+func (s *Server) verify(c *conn, jobID string, nonce []byte) (Share, error) {
+	s.mtx.Lock()
+	subscribed := c.subscribed
+	j := s.jobs[jobID]
+	s.mtx.Unlock()
+	if !subscribed {
+		return Share{}, &Error{CodeNotSubscribed, "not subscribed"}
+	}
+	if j == nil {
+		return Share{}, &Error{CodeJobNotFound, "job not found"}
+	}
+	if j.c != c {
+		return Share{}, &Error{CodeJobNotFound, "job was handed to another client"}
+	}
+
+	// Only the shortest encoding of a nonce is accepted, so a nonce can't be submitted twice in disguise
+	n := lxr.NonceValue(nonce)
+	if len(nonce) > 8 || !bytes.Equal(lxr.LittleEndianNonce(nil, n), nonce) {
+		return Share{}, &Error{CodeInvalidParams, "nonce is not little endian in as few bytes as it needs"}
+	}
+	if n < j.Start || n >= j.End {
+		return Share{}, &Error{CodeNonceOutOfJob, "nonce is not in the job"}
+	}
+
+	hash := s.hash.Hash(append(append([]byte{}, j.Data...), nonce...))
+	d := lxr.Difficulty(hash)
+	if d < j.Target {
+		return Share{}, &Error{CodeLowDifficulty, "low difficulty share"}
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	if s.jobs[jobID] != j {
+		return Share{}, &Error{CodeJobNotFound, "job not found"}
+	}
+	if _, dup := s.shares[n]; dup {
+		return Share{}, &Error{CodeDuplicateShare, "duplicate share"}
+	}
+	s.shares[n] = struct{}{}
+	return Share{Worker: c.worker, JobID: jobID, Nonce: nonce, Hash: hash, Difficulty: d}, nil
+}
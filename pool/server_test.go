@@ -0,0 +1,381 @@
+package pool
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	lxr "github.com/pegnet/LXRHash"
+)
+
+const testTarget = 0xF000000000000000
+
+// newTestHash returns a small LXRHash, with its table in a temporary directory
+func newTestHash(t *testing.T) *lxr.LXRHash {
+	lx, err := lxr.NewParams(lxr.Params{Seed: lxr.Seed, MapSizeBits: 8, HashSize: lxr.HashSize, Passes: lxr.Passes}, lxr.WithDir(t.TempDir()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lx
+}
+
+// startServer starts a Server on a localhost port
+func startServer(t *testing.T, lx *lxr.LXRHash, opts ServerOptions) (*Server, string) {
+	s := NewServer(lx, opts)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Close() })
+	return s, l.Addr().String()
+}
+
+// code returns the code of a pool Error, or 0
+func code(err error) int {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return 0
+}
+
+// findNonce returns the first nonce of j with a hash that is a share, or isn't
+func findNonce(lx *lxr.LXRHash, j Job, share bool) []byte {
+	for n := j.Start; n < j.End; n++ {
+		nonce := lxr.LittleEndianNonce(nil, n)
+		d := lxr.Difficulty(lx.Hash(append(append([]byte{}, j.Data...), nonce...)))
+		if (d >= j.Target) == share {
+			return nonce
+		}
+	}
+	return nil
+}
+
+func TestServer_Submit(t *testing.T) {
+	lx := newTestHash(t)
+	var accepted []Share
+	s, addr := startServer(t, lx, ServerOptions{RangeSize: 1000, Target: testTarget, OnShare: func(s Share) { accepted = append(accepted, s) }})
+	ctx := context.Background()
+
+	c, err := Dial(ctx, addr, "tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Params() != lx.Params() || c.Session() == "" {
+		t.Errorf("subscribed with params %+v, session %q", c.Params(), c.Session())
+	}
+	if _, err := c.GetJob(ctx, ""); code(err) != CodeOther {
+		t.Errorf("expected no work, got %v", err)
+	}
+
+	s.SetWork([]byte("some data"))
+	var notified Job
+	select {
+	case n := <-c.Jobs():
+		if !n.Clean || string(n.Data) != "some data" {
+			t.Errorf("bad notification %+v", n)
+		}
+		notified = n
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification of new work")
+	}
+	// Until the client says it has finished the job it was sent, it gets that job again
+	j, err := c.GetJob(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if j.ID != notified.ID || j.Clean {
+		t.Errorf("got job %+v, not the job %+v sent with the work", j, notified)
+	}
+	if string(j.Data) != "some data" || j.End-j.Start != 1000 || j.Target != testTarget {
+		t.Errorf("bad job %+v", j)
+	}
+	share := findNonce(lx, j, true)
+	if err := c.Submit(ctx, j.ID, share); err != nil {
+		t.Fatalf("share rejected: %v", err)
+	}
+	if len(accepted) != 1 || accepted[0].Worker != "tester" || lxr.Difficulty(accepted[0].Hash) < testTarget {
+		t.Errorf("OnShare not called with the share: %+v", accepted)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		job   string
+		nonce []byte
+		code  int
+	}{
+		{"duplicate", j.ID, share, CodeDuplicateShare},
+		{"low difficulty", j.ID, findNonce(lx, j, false), CodeLowDifficulty},
+		{"out of job", j.ID, lxr.LittleEndianNonce(nil, j.End), CodeNonceOutOfJob},
+		{"not shortest", j.ID, append(append([]byte{}, share...), 0), CodeInvalidParams},
+		{"unknown job", "nope", share, CodeJobNotFound},
+	} {
+		if err := c.Submit(ctx, tc.job, tc.nonce); code(err) != tc.code {
+			t.Errorf("%s: expected code %d, got %v", tc.name, tc.code, err)
+		}
+	}
+
+	// Finishing a job gets the next, and shares for the finished one are no longer taken
+	j2, err := c.GetJob(ctx, j.ID)
+	if err != nil || j2.Start != j.End || j2.ID == j.ID {
+		t.Errorf("second job %+v does not follow %+v: %v", j2, j, err)
+	}
+	if err := c.Submit(ctx, j.ID, findNonce(lx, j, true)); code(err) != CodeJobNotFound {
+		t.Errorf("expected job not found for a finished job, got %v", err)
+	}
+
+	// New work replaces the old jobs, and is pushed to the client
+	s.SetWork([]byte("other data"))
+	select {
+	case n := <-c.Jobs():
+		if !n.Clean || string(n.Data) != "other data" {
+			t.Errorf("bad notification %+v", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no notification of new work")
+	}
+	if err := c.Submit(ctx, j2.ID, findNonce(lx, j2, true)); code(err) != CodeJobNotFound {
+		t.Errorf("expected job not found for old work, got %v", err)
+	}
+}
+
+func TestServer_Protocol(t *testing.T) {
+	_, addr := startServer(t, newTestHash(t), ServerOptions{})
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+
+	for _, tc := range []struct{ req, want string }{
+		{`{"jsonrpc":"2.0","id":1,"method":"mining.getjob"}`, `"code":25`},
+		{`{"jsonrpc":"2.0","id":2,"method":"mining.dance"}`, `"code":-32601`},
+		{`{"jsonrpc":"2.0","id":3,"method":"mining.subscribe","params":{"worker":7}}`, `"code":-32602`},
+		{`{"jsonrpc":"2.0","method":"mining.subscribe"}`, `"code":-32600`},
+		{`{"jsonrpc":"2.0","id":"a","method":"mining.subscribe","params":{"worker":"w"}}`, `"id":"a","result":{"session":"`},
+		{`{"jsonrpc":"2.0","id":4,"method":"mining.submit","params":{"job_id":"1","nonce":"zz"}}`, `"code":-32602`},
+		{`{not json`, `"code":-32700`},
+	} {
+		if _, err := nc.Write([]byte(tc.req + "\n")); err != nil {
+			t.Fatal(err)
+		}
+		nc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%s: %v", tc.req, err)
+		}
+		if !strings.Contains(line, tc.want) {
+			t.Errorf("%s: got %s, want %s", tc.req, line, tc.want)
+		}
+	}
+}
+
+func TestServer_Nonces(t *testing.T) {
+	s, addr := startServer(t, newTestHash(t), ServerOptions{RangeSize: 100, Nonces: lxr.NonceRange{Start: 1000, End: 1250}})
+	s.SetWork([]byte("data"))
+	ctx := context.Background()
+
+	a, err := Dial(ctx, addr, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := a.GetJob(ctx, "")
+	if err != nil || j.Start != 1000 || j.End != 1100 {
+		t.Fatalf("first job %+v, %v", j, err)
+	}
+
+	// The jobs of a client that goes away are handed out again, once the server sees it go
+	a.Close()
+	b, err := Dial(ctx, addr, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	var got []lxr.NonceRange
+	var total uint64
+	var done string
+	deadline := time.Now().Add(5 * time.Second)
+	for total < 250 && time.Now().Before(deadline) {
+		j, err := b.GetJob(ctx, done)
+		if err != nil {
+			if code(err) != CodeOther {
+				t.Fatalf("expected no nonces left, got %v", err)
+			}
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		got = append(got, lxr.NonceRange{Start: j.Start, End: j.End})
+		total += j.End - j.Start
+		done = j.ID
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Start < got[j].Start })
+	want := []lxr.NonceRange{{Start: 1000, End: 1100}, {Start: 1100, End: 1200}, {Start: 1200, End: 1250}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("jobs %v, want %v", got, want)
+	}
+	if _, err := b.GetJob(ctx, done); code(err) != CodeOther {
+		t.Errorf("expected no nonces left, got %v", err)
+	}
+}
+
+func TestServer_FinishedJobs(t *testing.T) {
+	s, addr := startServer(t, newTestHash(t), ServerOptions{RangeSize: 100, Nonces: lxr.NonceRange{Start: 0, End: 300}})
+	s.SetWork([]byte("data"))
+	ctx := context.Background()
+
+	a, err := Dial(ctx, addr, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j1, err := a.GetJob(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j2, err := a.GetJob(ctx, j1.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the job in progress is handed out again once the client goes away
+	a.Close()
+	b, err := Dial(ctx, addr, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	var got []lxr.NonceRange
+	var done string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(got) < 2 && time.Now().Before(deadline) {
+		j, err := b.GetJob(ctx, done)
+		if err != nil {
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+		got = append(got, lxr.NonceRange{Start: j.Start, End: j.End})
+		done = j.ID
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].Start < got[j].Start })
+	want := []lxr.NonceRange{{Start: j2.Start, End: j2.End}, {Start: 200, End: 300}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("jobs %v, want %v", got, want)
+	}
+	for _, r := range got {
+		if r.Start < j1.End && j1.Start < r.End {
+			t.Errorf("finished job %d to %d handed out again as %v", j1.Start, j1.End, r)
+		}
+	}
+	if _, err := b.GetJob(ctx, done); code(err) != CodeOther {
+		t.Errorf("expected no nonces left, got %v", err)
+	}
+}
+
+func TestServer_JobsPerClient(t *testing.T) {
+	lx := newTestHash(t)
+	s, addr := startServer(t, lx, ServerOptions{RangeSize: 100, Target: testTarget})
+	s.SetWork([]byte("data"))
+	ctx := context.Background()
+
+	a, err := Dial(ctx, addr, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := Dial(ctx, addr, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// A client that stays on the same work only holds the job it is working
+	var j Job
+	for i := 0; i < 50; i++ {
+		if j, err = a.GetJob(ctx, j.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.mtx.Lock()
+	jobs := len(s.jobs)
+	s.mtx.Unlock()
+	if jobs != 1 {
+		t.Errorf("server holds %d jobs", jobs)
+	}
+
+	// Shares are only taken from the client the job was handed to
+	share := findNonce(lx, j, true)
+	if err := b.Submit(ctx, j.ID, share); code(err) != CodeJobNotFound {
+		t.Errorf("expected job not found for another client's job, got %v", err)
+	}
+	if err := a.Submit(ctx, j.ID, share); err != nil {
+		t.Errorf("share rejected: %v", err)
+	}
+}
+
+func TestServer_SetWorkCrossesGetJob(t *testing.T) {
+	lx := newTestHash(t)
+	s, addr := startServer(t, lx, ServerOptions{RangeSize: 100, Nonces: lxr.NonceRange{Start: 0, End: 300}, Target: testTarget})
+	ctx := context.Background()
+	a, err := Dial(ctx, addr, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	notified := func() Job {
+		select {
+		case n := <-a.Jobs():
+			return n
+		case <-time.After(5 * time.Second):
+			t.Fatal("no notification of new work")
+		}
+		return Job{}
+	}
+
+	s.SetWork([]byte("old"))
+	old := notified()
+
+	// New work is sent as the client asks for a job, having finished the old one
+	s.SetWork([]byte("new"))
+	j, err := a.GetJob(ctx, old.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := notified()
+	if j.ID != n.ID || string(j.Data) != "new" {
+		t.Fatalf("got job %+v, not the job %+v sent with the work", j, n)
+	}
+
+	// The job sent with the work is still the client's, and still to be searched
+	if err := a.Submit(ctx, j.ID, findNonce(lx, j, true)); err != nil {
+		t.Errorf("share for the job sent with the work rejected: %v", err)
+	}
+	a.Close()
+	b, err := Dial(ctx, addr, "b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	var done string
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		bj, err := b.GetJob(ctx, done)
+		if err == nil && bj.Start == j.Start {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("the range of job %+v was never handed out again", j)
+		}
+		if err == nil {
+			done = bj.ID
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+}
@@ -1,124 +1,383 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/signal"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
 
 	lxr "github.com/pegnet/LXRHash"
+	"github.com/pegnet/LXRHash/pool"
 )
 
-var total uint64
-var now = time.Now()
+// defaultData is mined when no base data is given
+const defaultData = "000000000200000000020000000002000"
 
-var prt chan string
+// config holds the settings of a mining run, from the command line
+type config struct {
+	hash         string // lxrhash or sha256
+	workers      int
+	data         []byte // Base data the nonces are appended to
+	params       lxr.Params
+	dir          string
+	target       uint64
+	exitOnTarget bool
+	duration     time.Duration
+	interval     time.Duration
+	format       string
+	perWorker    bool           // Report the rates of each worker in the text output
+	nonces       lxr.NonceRange // Nonces to search, i.e. this machine's part of them
+	chunk        uint64         // Nonces a worker takes at a time
+	checkpoint   string         // File the state of the run is saved to
+	saveEvery    time.Duration  // Time between checkpoints
+	resume       bool           // Resume the run saved in the checkpoint
+	pool         string         // Address of a pool to mine for, instead of mining data
+	worker       string         // Name given to the pool
+}
 
-var LX *lxr.LXRHash
+func usage(fs *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintln(fs.Output(), "Usage:\n\n"+
+			"simMiner [flags] [<hash> [bits]]\n"+
+			"simMiner verify [flags]\n"+
+			"simMiner serve [flags]\n\n"+
+			"<hash> is equal to LXRHash to sim mine LXRHash, the same as -hash lxrhash\n"+
+			"<hash> is equal to Sha256 to sim mine Sha256, the same as -hash sha256\n"+
+			"[bits] is the same as -bits\n"+
+			"verify checks a table file; see simMiner verify -h\n"+
+			"serve runs a pool for simMiner -pool to mine for; see simMiner serve -h\n\n"+
+			"Flags:")
+		fs.PrintDefaults()
+	}
+}
 
-func mine(useLXR bool, data []byte) uint64 {
+// parseFlags returns the config given by the command line args, without the program name
+func parseFlags(args []string) (*config, error) {
+	c := &config{params: lxr.DefaultParams}
+	var data, dataFile, format, part string
 
-	cd := uint64(0)
-	dlen := len(data)
-	for i := 0; ; i++ {
-		data = data[:dlen]
-		for b := i; b > 0; b = b >> 8 {
-			data = append(data, byte(b))
+	fs := flag.NewFlagSet("simMiner", flag.ContinueOnError)
+	fs.Usage = usage(fs)
+	fs.StringVar(&c.hash, "hash", "lxrhash", "hash to mine, lxrhash or sha256")
+	fs.IntVar(&c.workers, "workers", runtime.NumCPU(), "number of mining goroutines")
+	fs.StringVar(&data, "data", "", "base data to mine, in hex (default \""+defaultData+"\" as text)")
+	fs.StringVar(&dataFile, "data-file", "", "file holding the base data to mine")
+	fs.Uint64Var(&c.params.Seed, "seed", c.params.Seed, "seed of the table")
+	fs.Uint64Var(&c.params.Passes, "passes", c.params.Passes, "shuffle passes of the table")
+	fs.Uint64Var(&c.params.MapSizeBits, "bits", c.params.MapSizeBits, "bits in the ByteMap index.  Lower numbers are quicker to initialize")
+	fs.Uint64Var(&c.params.HashSize, "hashsize", c.params.HashSize, "bits in the hash")
+	fs.StringVar(&c.dir, "dir", "", "directory holding table files (default: see lxr.TableDir)")
+	fs.Uint64Var(&c.target, "target", 0, "target difficulty, i.e. 0xffff000000000000")
+	fs.BoolVar(&c.exitOnTarget, "exit-on-target", false, "stop once a hash meets the target")
+	fs.DurationVar(&c.duration, "duration", 0, "stop after this long (default: run until interrupted)")
+	fs.DurationVar(&c.interval, "interval", 10*time.Second, "time between status reports")
+	fs.StringVar(&format, "format", "text", "output format, text or json (JSON lines)")
+	fs.BoolVar(&c.perWorker, "per-worker", false, "report the hash rates of each worker as well as the total (JSON always has them)")
+	fs.StringVar(&part, "part", "", "search only part i/n of the nonces, i.e. 0/4 to 3/4 for four machines (default: all of them)")
+	fs.Uint64Var(&c.chunk, "chunk", 1<<20, "nonces a worker takes at a time")
+	fs.StringVar(&c.checkpoint, "checkpoint", "", "file to save the state of the run to, so it can be resumed")
+	fs.DurationVar(&c.saveEvery, "checkpoint-every", 30*time.Second, "time between checkpoints")
+	fs.BoolVar(&c.resume, "resume", false, "resume the run saved in -checkpoint, with its data, hash, and table")
+	fs.StringVar(&c.pool, "pool", "", "address of a pool to mine jobs for.  The pool sets the data, table, and share target")
+	fs.StringVar(&c.worker, "worker", defaultWorker(), "worker name to give the pool")
+	// Flags may come before or after the original positional arguments, <hash> [bits]
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
 		}
-		var hash []byte
-		if useLXR {
-			hash = LX.Hash(data)
-		} else {
-			h := sha256.Sum256(data)
-			hash = h[:]
+		if args = fs.Args(); len(args) == 0 {
+			break
+		}
+		positional, args = append(positional, args[0]), args[1:]
+	}
+	if len(positional) > 2 {
+		return nil, fmt.Errorf("too many arguments: %q", positional)
+	}
+	if len(positional) > 0 {
+		c.hash = positional[0]
+	}
+	if len(positional) > 1 {
+		b, err := strconv.ParseUint(positional[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad bits: %v", err)
 		}
+		c.params.MapSizeBits = b
+	}
 
-		total++
+	c.hash = strings.ToLower(c.hash)
+	if c.hash != "lxrhash" && c.hash != "sha256" {
+		return nil, fmt.Errorf("unknown hash %q", c.hash)
+	}
+	if c.workers < 1 {
+		return nil, fmt.Errorf("need at least one worker, not %d", c.workers)
+	}
+	c.format = strings.ToLower(format)
+	if c.format != "text" && c.format != "json" {
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	if c.pool != "" && c.hash != "lxrhash" {
+		return nil, errors.New("a pool can only be mined with lxrhash")
+	}
+	if c.checkpoint != "" && c.pool != "" {
+		return nil, errors.New("a pool keeps track of the nonces, so -checkpoint can't be used with -pool")
+	}
+	if c.resume && c.checkpoint == "" {
+		return nil, errors.New("-resume needs a -checkpoint to resume")
+	}
+	if c.saveEvery <= 0 {
+		return nil, fmt.Errorf("bad checkpoint interval %v", c.saveEvery)
+	}
+	if c.exitOnTarget && c.pool != "" {
+		return nil, errors.New("-exit-on-target can't be used with a pool")
+	}
+	if c.exitOnTarget && c.target == 0 {
+		return nil, errors.New("-exit-on-target needs a -target")
+	}
+	if c.interval <= 0 {
+		return nil, fmt.Errorf("bad interval %v", c.interval)
+	}
+	if c.chunk == 0 {
+		return nil, errors.New("-chunk must be at least 1")
+	}
+	c.nonces = lxr.AllNonces
+	if part != "" {
+		var i, n int
+		if _, err := fmt.Sscanf(part, "%d/%d", &i, &n); err != nil || n < 1 || i < 0 || i >= n {
+			return nil, fmt.Errorf("bad part %q, want i/n with 0 <= i < n", part)
+		}
+		c.nonces = lxr.AllNonces.Split(n)[i]
+	}
 
-		d := uint64(0)
-		for i := 0; i < 8; i++ {
-			d = d<<8 + uint64(hash[i])
+	switch {
+	case data != "" && dataFile != "":
+		return nil, errors.New("give -data or -data-file, not both")
+	case data != "":
+		d, err := hex.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("bad data: %v", err)
+		}
+		c.data = d
+	case dataFile != "":
+		d, err := ioutil.ReadFile(dataFile)
+		if err != nil {
+			return nil, err
 		}
-		if cd < d {
-			cd = d
-			running := time.Since(now)
-			hps := float64(total) / running.Seconds()
-			prt <- fmt.Sprintf("%10d %16x %8x %10.0f hps\n", total, cd, i, hps)
+		c.data = d
+	default:
+		c.data = []byte(defaultData)
+	}
 
+	if c.hash == "lxrhash" {
+		if err := c.params.Validate(); err != nil {
+			return nil, err
 		}
 	}
-	return cd
+	return c, nil
 }
 
-func main() {
+// defaultWorker returns the host name, as the default name of a pool worker
+func defaultWorker() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return "simMiner"
+	}
+	return name
+}
 
-	leave := func() {
-		fmt.Println("Usage:\n\n" +
-			"simMiner <hash> [bits]\n\n" +
-			"<hash> is equal to LXRHash to sim mine LXRHash\n" +
-			"<hash> is equal to Sha256 to sim mine Sha256\n" +
-			"[bits] defaults to 30, but lower numbers can be quicker to initialize")
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(verify(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		os.Exit(serve(os.Args[2:]))
+	}
+	c, err := parseFlags(os.Args[1:])
+	if err == flag.ErrHelp {
 		os.Exit(0)
 	}
-
-	if len(os.Args) < 2 {
-		leave()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
+	os.Exit(run(c))
+}
 
-	h := strings.ToLower(os.Args[1])
-	hash := h == "lxrhash"
-	if !hash && h != "sha256" {
-		leave()
+// run mines as c says, and returns the exit status.  With -exit-on-target, that is 1 if the target
+// was not met.  Mining for a pool, it is 1 if the pool goes away.
+func run(c *config) int {
+	out := newOutput(c.format, c.perWorker, os.Stdout)
+
+	// A run resumed takes its data, hash, table, and nonces from the checkpoint
+	var resumed *checkpoint
+	if c.resume {
+		var err error
+		if resumed, err = loadCheckpoint(c.checkpoint); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		c.hash, c.data = resumed.Hash, resumed.Data
+		if resumed.Params != nil {
+			c.params = *resumed.Params
+		}
 	}
 
-	bits := lxr.MapSizeBits
-	if hash {
-		if len(os.Args) == 3 {
-			b, err := strconv.Atoi(os.Args[2])
-			if err != nil {
-				fmt.Println(err)
-				leave()
-			}
-			if b > 40 || b < 8 {
-				fmt.Println("Bits specified must be at least 8 and less than or equal to 40.  40 bits is 1 TB")
-			}
-			bits = uint64(b)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if c.duration > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.duration)
+		defer cancel()
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		select {
+		case <-interrupt:
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
 
-		LX = new(lxr.LXRHash)
-		LX.Init(lxr.Seed, bits, lxr.HashSize, lxr.Passes)
+	// A pool says which table to use
+	var client *pool.Client
+	if c.pool != "" {
+		var err error
+		if client, err = pool.Dial(ctx, c.pool, c.worker); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		defer client.Close()
+		c.params = client.Params()
+		out.info(fmt.Sprintf("Mining for the pool at %s as %s", c.pool, c.worker))
 	}
 
-	if hash {
-		fmt.Println("Using LXRHash with a ", bits, " bit addressable ByteMap")
+	opts := lxr.MineOptions{Workers: c.workers, Counts: make([]uint64, c.workers)}
+	var lx *lxr.LXRHash
+	var hash func(src []byte) []byte
+	if c.hash == "lxrhash" {
+		var err error
+		if lx, err = lxr.NewParams(c.params, lxr.WithDir(c.dir), lxr.WithLogger(out)); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		defer lx.Close()
+		opts.Hash, hash = lx, lx.Hash
+		out.info(fmt.Sprintf("Using LXRHash with a %d bit addressable ByteMap", c.params.MapSizeBits))
 	} else {
-		fmt.Println("Using Sha256")
+		hash = func(src []byte) []byte { h := sha256.Sum256(src); return h[:] }
+		opts.HashFunc = hash
+		out.info("Using Sha256")
 	}
 
-	prt = make(chan string, 500)
-	go mine(hash, []byte("000000000200000000020000000002000"))
-	go mine(hash, []byte("000000000200000000020000000002001"))
-	go mine(hash, []byte("000000000200000000020000000002002"))
-	go mine(hash, []byte("000000000200000000020000000002003"))
+	start := time.Now()
+	m := newMeter(opts.Counts, start)
 
-	go mine(hash, []byte("000000000200000000020000000002004"))
-	go mine(hash, []byte("000000000200000000020000000002005"))
-	go mine(hash, []byte("000000000200000000020000000002006"))
-	go mine(hash, []byte("000000000200000000020000000002006"))
+	best := new(progress)
+	met := false
+	var prior uint64 // Hashes made by the run resumed
+	opts.Nonces = lxr.NewNonceAllocator(c.chunk, c.nonces)
+	if resumed != nil {
+		// The best hash is only trusted once it is checked with the table it is hashed with now
+		if err := resumed.verify(hash); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		prior = resumed.Hashes
+		opts.Nonces = lxr.NewNonceAllocator(c.chunk, resumed.nonces()...)
+		out.info(fmt.Sprintf("Resuming from %s, saved %s after %d hashes", c.checkpoint, resumed.Time.Format(time.RFC3339), prior))
+		if len(resumed.BestHash) > 0 {
+			d := lxr.Difficulty(resumed.BestHash)
+			best.update(resumed.BestNonce, resumed.BestHash, d)
+			met = c.target != 0 && d >= c.target
+			out.best(prior, 0, resumed.BestNonce, resumed.BestHash, d, met)
+			if c.exitOnTarget && met {
+				out.info("Done")
+				return 0
+			}
+		}
+	}
+	save := func() {
+		if c.checkpoint == "" {
+			return
+		}
+		if err := best.checkpoint(c, opts.Nonces, prior+m.total()).save(c.checkpoint); err != nil {
+			out.info(fmt.Sprintf("Failed to save checkpoint: %v", err))
+		}
+	}
+	mine := func() error {
+		lxr.Mine(ctx, c.data, opts)
+		return nil
+	}
+	if client != nil {
+		// The pool hands out the nonces, and every job has a best of its own, so shares are reported instead
+		opts.Nonces = nil
+		mine = func() error {
+			return client.Work(ctx, lx, opts, func(s pool.Share, err error) {
+				out.share(s.JobID, s.Nonce, s.Difficulty, err)
+			})
+		}
+	} else {
+		opts.OnBest = func(nonce []byte, hash []byte, difficulty uint64) {
+			if !best.update(nonce, hash, difficulty) {
+				return // Not as good as the best of the run resumed
+			}
+			met = c.target != 0 && difficulty >= c.target
+			out.best(m.total(), time.Since(start), nonce, hash, difficulty, met)
+		}
+		if c.exitOnTarget {
+			opts.Target = c.target
+		}
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- mine()
+	}()
 
+	sampler := time.NewTicker(sampleEvery)
+	defer sampler.Stop()
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	var saves <-chan time.Time
+	if c.checkpoint != "" {
+		saver := time.NewTicker(c.saveEvery)
+		defer saver.Stop()
+		saves = saver.C
+	}
+	var err error
+loop:
 	for {
 		select {
-		case s := <-prt:
-			fmt.Print(s)
-			continue
-		default:
+		case now := <-sampler.C:
+			m.sample(now)
+		case now := <-ticker.C:
+			out.status(m.report(now))
+		case <-saves:
+			save()
+		case err = <-done:
+			break loop
 		}
-		time.Sleep(10 * time.Second)
-		running := time.Since(now)
-		hps := float64(total) / running.Seconds()
-		prt <- fmt.Sprintf("%10d %16s %8s %10.0f hps\n", total, "", "", hps)
+	}
+	out.status(m.report(time.Now()))
+	save()
+	if err != nil && ctx.Err() == nil {
+		out.info(err.Error())
+		return 1
+	}
+	out.info("Done")
 
+	if c.exitOnTarget && !met {
+		return 1
 	}
+	return 0
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	lxr "github.com/pegnet/LXRHash"
+)
+
+func TestParseFlags(t *testing.T) {
+	c, err := parseFlags(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.hash != "lxrhash" || c.params != lxr.DefaultParams || !bytes.Equal(c.data, []byte(defaultData)) || c.format != "text" {
+		t.Errorf("wrong defaults: %+v", c)
+	}
+
+	// The original positional arguments still work, around flags
+	c, err = parseFlags([]string{"-workers", "3", "Sha256", "12", "-format", "json", "-duration", "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.hash != "sha256" || c.params.MapSizeBits != 12 || c.workers != 3 || c.format != "json" || c.duration != time.Minute {
+		t.Errorf("flags not applied: %+v", c)
+	}
+
+	file := filepath.Join(t.TempDir(), "data")
+	if err := ioutil.WriteFile(file, []byte("file data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c, err = parseFlags([]string{"-data-file", file, "-target", "0xffff000000000000", "-exit-on-target", "-hashsize", "512"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(c.data) != "file data" || c.target != 0xffff000000000000 || !c.exitOnTarget || c.params.HashSize != 512 {
+		t.Errorf("flags not applied: %+v", c)
+	}
+	if c, err = parseFlags([]string{"-data", "00ff"}); err != nil || !bytes.Equal(c.data, []byte{0, 0xff}) {
+		t.Errorf("hex data not decoded: %v", err)
+	}
+
+	if c, err = parseFlags([]string{"-pool", "localhost:8400", "-worker", "rig1"}); err != nil || c.pool != "localhost:8400" || c.worker != "rig1" {
+		t.Errorf("pool flags not applied: %v", err)
+	}
+
+	if c, err = parseFlags([]string{"-part", "3/4", "-chunk", "10"}); err != nil || c.nonces != lxr.PrefixNonces(3, 2) || c.chunk != 10 {
+		t.Errorf("nonce flags not applied: %v", err)
+	}
+	if c, err = parseFlags([]string{"-checkpoint", "cp.json", "-checkpoint-every", "5s", "-resume"}); err != nil || c.checkpoint != "cp.json" || c.saveEvery != 5*time.Second || !c.resume {
+		t.Errorf("checkpoint flags not applied: %v", err)
+	}
+	if c, err = parseFlags(nil); err != nil || c.nonces != lxr.AllNonces {
+		t.Errorf("default nonces not all of them: %v", err)
+	}
+
+	for _, args := range [][]string{
+		{"md5"},
+		{"-part", "4/4"},
+		{"-part", "1"},
+		{"-chunk", "0"},
+		{"-resume"},
+		{"-checkpoint", "cp.json", "-pool", "localhost:8400"},
+		{"-checkpoint-every", "0"},
+		{"-pool", "localhost:8400", "sha256"},
+		{"-pool", "localhost:8400", "-target", "1", "-exit-on-target"},
+		{"lxrhash", "40"},
+		{"-bits", "7"},
+		{"-hashsize", "0"},
+		{"-workers", "0"},
+		{"-format", "xml"},
+		{"-exit-on-target"},
+		{"-data", "zz"},
+		{"-data", "00", "-data-file", file},
+		{"lxrhash", "10", "extra"},
+	} {
+		if _, err := parseFlags(args); err == nil {
+			t.Errorf("%q accepted", args)
+		}
+	}
+}
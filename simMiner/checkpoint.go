@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	lxr "github.com/pegnet/LXRHash"
+	"github.com/pegnet/LXRHash/pool"
+)
+
+// checkpointVersion is the version of the checkpoint file format written
+const checkpointVersion = 1
+
+// checkpoint is the state of a mining run, saved as JSON so a run that is stopped can be resumed
+type checkpoint struct {
+	Version   int              `json:"version"`
+	Time      time.Time        `json:"time"`
+	Hash      string           `json:"hash"`             // lxrhash or sha256
+	Data      pool.HexBytes    `json:"data"`             // Base data the nonces are appended to
+	Params    *lxr.Params      `json:"params,omitempty"` // Table of the LXRHash
+	Workers   []lxr.NonceRange `json:"workers"`          // Range each worker is in, from the next nonce it will try
+	Nonces    []lxr.NonceRange `json:"nonces"`           // Nonces not yet handed to a worker
+	Hashes    uint64           `json:"hashes"`           // Hashes made, over every run resumed
+	BestNonce pool.HexBytes    `json:"best_nonce"`       // Empty for nonce 0
+	BestHash  pool.HexBytes    `json:"best_hash"`        // Empty until a hash is made
+}
+
+// loadCheckpoint reads the checkpoint saved at path
+func loadCheckpoint(path string) (*checkpoint, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cp := new(checkpoint)
+	if err := json.Unmarshal(b, cp); err != nil {
+		return nil, fmt.Errorf("bad checkpoint %s: %v", path, err)
+	}
+	if cp.Version != checkpointVersion {
+		return nil, fmt.Errorf("checkpoint %s is version %d, not %d", path, cp.Version, checkpointVersion)
+	}
+	if cp.Hash == "lxrhash" && cp.Params == nil {
+		return nil, fmt.Errorf("checkpoint %s has no table params", path)
+	}
+	return cp, nil
+}
+
+// save writes cp to path.  The file is replaced in one step, so a run killed, or a machine that
+// crashes, while saving leaves the last checkpoint whole.
+func (cp *checkpoint) save(path string) error {
+	b, err := json.MarshalIndent(cp, "", "  ")
+	if err != nil {
+		return err
+	}
+	return lxr.WriteFileAtomic(path, 0644, func(w io.Writer) error {
+		_, err := w.Write(append(b, '\n'))
+		return err
+	})
+}
+
+// nonces returns the nonces left to search
+func (cp *checkpoint) nonces() []lxr.NonceRange {
+	return append(append([]lxr.NonceRange{}, cp.Workers...), cp.Nonces...)
+}
+
+// verify hashes the best nonce again, and returns an error if it doesn't give the best hash
+func (cp *checkpoint) verify(hash func(src []byte) []byte) error {
+	if len(cp.BestHash) == 0 {
+		if len(cp.BestNonce) != 0 {
+			return errors.New("checkpoint has a best nonce but no best hash")
+		}
+		return nil
+	}
+	h := hash(append(append([]byte{}, cp.Data...), cp.BestNonce...))
+	if !bytes.Equal(h, cp.BestHash) {
+		return fmt.Errorf("best nonce %x of the checkpoint hashes to %x, not %x", []byte(cp.BestNonce), h, []byte(cp.BestHash))
+	}
+	return nil
+}
+
+// progress is the best hash found so far, kept for checkpoints as the workers find better ones
+type progress struct {
+	mtx        sync.Mutex
+	found      bool
+	nonce      []byte
+	hash       []byte
+	difficulty uint64
+}
+
+// update records a hash, and returns true if it is the best so far
+func (p *progress) update(nonce, hash []byte, difficulty uint64) bool {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.found && difficulty <= p.difficulty {
+		return false
+	}
+	p.found = true
+	p.nonce = append(p.nonce[:0], nonce...)
+	p.hash = append(p.hash[:0], hash...)
+	p.difficulty = difficulty
+	return true
+}
+
+// checkpoint returns the state of a run mining data with c, and with nonces left to search
+func (p *progress) checkpoint(c *config, nonces *lxr.NonceAllocator, hashes uint64) *checkpoint {
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	inProgress, unallocated := nonces.Ranges()
+	if inProgress == nil {
+		inProgress = []lxr.NonceRange{} // No worker is in a range, rather than no record of them
+	}
+	cp := &checkpoint{
+		Version:   checkpointVersion,
+		Time:      time.Now(),
+		Hash:      c.hash,
+		Data:      c.data,
+		Workers:   inProgress,
+		Nonces:    unallocated,
+		Hashes:    hashes,
+		BestNonce: append([]byte{}, p.nonce...),
+		BestHash:  append([]byte{}, p.hash...),
+	}
+	if c.hash == "lxrhash" {
+		params := c.params
+		cp.Params = &params
+	}
+	return cp
+}
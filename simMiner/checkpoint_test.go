@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	lxr "github.com/pegnet/LXRHash"
+)
+
+func sha(src []byte) []byte {
+	h := sha256.Sum256(src)
+	return h[:]
+}
+
+func TestCheckpoint_SaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	params := lxr.DefaultParams
+	cp := &checkpoint{
+		Version:   checkpointVersion,
+		Time:      time.Now().UTC().Round(time.Second),
+		Hash:      "lxrhash",
+		Data:      []byte("data"),
+		Params:    &params,
+		Workers:   []lxr.NonceRange{{Start: 10, End: 20}},
+		Nonces:    []lxr.NonceRange{{Start: 30, End: lxr.AllNonces.End}},
+		Hashes:    25,
+		BestNonce: []byte{5},
+		BestHash:  []byte{1, 2, 3},
+	}
+	if err := cp.save(path); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, cp) {
+		t.Errorf("loaded %+v, saved %+v", got, cp)
+	}
+	if n := got.nonces(); !reflect.DeepEqual(n, []lxr.NonceRange{{Start: 10, End: 20}, {Start: 30, End: lxr.AllNonces.End}}) {
+		t.Errorf("nonces() = %v", n)
+	}
+
+	for name, bad := range map[string]func(*checkpoint){
+		"version":   func(c *checkpoint) { c.Version = checkpointVersion + 1 },
+		"no params": func(c *checkpoint) { c.Params = nil },
+	} {
+		c := *cp
+		bad(&c)
+		b, _ := json.Marshal(&c)
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadCheckpoint(path); err == nil {
+			t.Errorf("checkpoint with bad %s loaded", name)
+		}
+	}
+}
+
+func TestCheckpoint_Verify(t *testing.T) {
+	cp := &checkpoint{Data: []byte("data"), BestNonce: []byte{7}}
+	cp.BestHash = sha([]byte("data\x07"))
+	if err := cp.verify(sha); err != nil {
+		t.Errorf("good best hash rejected: %v", err)
+	}
+	cp.BestHash[0] ^= 1
+	if err := cp.verify(sha); err == nil {
+		t.Error("bad best hash accepted")
+	}
+	cp.BestHash = nil
+	if err := cp.verify(sha); err == nil {
+		t.Error("best nonce without a hash accepted")
+	}
+	if err := (&checkpoint{}).verify(sha); err != nil {
+		t.Errorf("checkpoint with nothing found rejected: %v", err)
+	}
+}
+
+// covered returns the nonces a checkpoint has searched, for a run that started with all of them
+func covered(cp *checkpoint) uint64 {
+	left := uint64(0)
+	for _, r := range cp.nonces() {
+		left += r.Len()
+	}
+	return lxr.AllNonces.Len() - left
+}
+
+func TestRun_Resume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	c, err := parseFlags([]string{"sha256", "-workers", "2", "-chunk", "1000", "-duration", "300ms", "-checkpoint", path, "-format", "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := run(c); status != 0 {
+		t.Fatalf("run exited %d", status)
+	}
+	first, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Hashes == 0 || covered(first) != first.Hashes || len(first.BestHash) == 0 {
+		t.Fatalf("checkpoint has %d hashes, covering %d nonces, best %x", first.Hashes, covered(first), []byte(first.BestHash))
+	}
+	if err := first.verify(sha); err != nil {
+		t.Error(err)
+	}
+
+	// Resuming takes the data from the checkpoint, and goes on without hashing a nonce twice
+	c, err = parseFlags([]string{"-resume", "-workers", "3", "-chunk", "1000", "-duration", "300ms", "-checkpoint", path, "-format", "json", "-data", "00"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := run(c); status != 0 {
+		t.Fatalf("resumed run exited %d", status)
+	}
+	second, err := loadCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.Hash != "sha256" || string(second.Data) != defaultData {
+		t.Errorf("resumed run mined %s of %x", second.Hash, []byte(second.Data))
+	}
+	if second.Hashes <= first.Hashes || covered(second) != second.Hashes {
+		t.Errorf("resumed checkpoint has %d hashes, covering %d nonces, after %d", second.Hashes, covered(second), first.Hashes)
+	}
+	if lxr.Difficulty(second.BestHash) < lxr.Difficulty(first.BestHash) {
+		t.Errorf("best went from %x to %x", []byte(first.BestHash), []byte(second.BestHash))
+	}
+	if err := second.verify(sha); err != nil {
+		t.Error(err)
+	}
+
+	// A checkpoint whose best hash is wrong is not resumed
+	second.BestHash[0] ^= 1
+	if err := second.save(path); err != nil {
+		t.Fatal(err)
+	}
+	if status := run(c); status != 2 {
+		t.Errorf("run with a bad checkpoint exited %d", status)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	lxr "github.com/pegnet/LXRHash"
+)
+
+// output reports the progress of a mining run.  Calls may come from any goroutine.
+type output interface {
+	lxr.Logger
+	info(msg string)
+	best(hashes uint64, elapsed time.Duration, nonce, hash []byte, difficulty uint64, met bool)
+	status(r report)
+	share(job string, nonce []byte, difficulty uint64, err error) // A share submitted to a pool, and err if it was rejected
+}
+
+func newOutput(format string, perWorker bool, w io.Writer) output {
+	if format == "json" {
+		return &jsonOutput{enc: json.NewEncoder(w)}
+	}
+	return &textOutput{w: w, perWorker: perWorker}
+}
+
+// rate returns the hashes per second over elapsed
+func rate(hashes uint64, elapsed time.Duration) float64 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(hashes) / elapsed.Seconds()
+}
+
+// textOutput writes the columns simMiner has always written: hashes, difficulty, nonce, and lifetime hash
+// rate.  Status lines add the instantaneous and windowed rates.
+type textOutput struct {
+	mtx       sync.Mutex
+	w         io.Writer
+	perWorker bool
+}
+
+func (o *textOutput) Log(level lxr.Level, msg string, kv ...interface{}) {
+	if level >= lxr.LevelInfo {
+		o.info(lxr.FormatEvent(msg, kv))
+	}
+}
+
+func (o *textOutput) info(msg string) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	fmt.Fprintln(o.w, msg)
+}
+
+func (o *textOutput) best(hashes uint64, elapsed time.Duration, nonce, hash []byte, difficulty uint64, met bool) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	mark := ""
+	if met {
+		mark = " target"
+	}
+	fmt.Fprintf(o.w, "%10d %16x %8x %10.0f hps%s\n", hashes, difficulty, lxr.NonceValue(nonce), rate(hashes, elapsed), mark)
+}
+
+func (o *textOutput) status(r report) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	fmt.Fprintf(o.w, "%10d %16s %8s %10.0f hps  now %.0f  1m %.0f  5m %.0f\n", r.Hashes, "", "", r.Total.Lifetime, r.Total.Now, r.Total.Minute, r.Total.Five)
+	if o.perWorker {
+		for w, wr := range r.Workers {
+			fmt.Fprintf(o.w, "%10d %16s %8d %10.0f hps  now %.0f  1m %.0f  5m %.0f\n", r.WorkerHashes[w], "worker", w, wr.Lifetime, wr.Now, wr.Minute, wr.Five)
+		}
+	}
+}
+
+func (o *textOutput) share(job string, nonce []byte, difficulty uint64, err error) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	verdict := "accepted"
+	if err != nil {
+		verdict = "rejected: " + err.Error()
+	}
+	fmt.Fprintf(o.w, "%10s %16x %8x job %s %s\n", "share", difficulty, lxr.NonceValue(nonce), job, verdict)
+}
+
+// jsonOutput writes an event object per line
+type jsonOutput struct {
+	mtx sync.Mutex
+	enc *json.Encoder
+}
+
+// message is a line of JSON output with a message
+type message struct {
+	Event   string    `json:"event"` // info
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// event is a line of JSON output reporting progress
+type event struct {
+	Event      string    `json:"event"` // best, status, or share
+	Time       time.Time `json:"time"`
+	Hashes     uint64    `json:"hashes"`
+	Elapsed    float64   `json:"elapsed"` // seconds
+	HPS        float64   `json:"hps"`
+	Nonce      string    `json:"nonce,omitempty"`      // hex
+	Hash       string    `json:"hash,omitempty"`       // hex
+	Difficulty string    `json:"difficulty,omitempty"` // hex, as in the text output
+	Target     bool      `json:"target,omitempty"`     // The hash meets the target
+	Rates      *rates    `json:"rates,omitempty"`      // Status only
+	Workers    []worker  `json:"workers,omitempty"`    // Status only
+	Job        string    `json:"job,omitempty"`        // Share only
+	Error      string    `json:"error,omitempty"`      // Why a share was rejected
+}
+
+// worker is the status of a worker in JSON output
+type worker struct {
+	Hashes uint64 `json:"hashes"`
+	Rates  rates  `json:"rates"`
+}
+
+func (o *jsonOutput) write(v interface{}) {
+	o.mtx.Lock()
+	defer o.mtx.Unlock()
+	o.enc.Encode(v)
+}
+
+func (o *jsonOutput) Log(level lxr.Level, msg string, kv ...interface{}) {
+	if level >= lxr.LevelInfo {
+		o.info(lxr.FormatEvent(msg, kv))
+	}
+}
+
+func (o *jsonOutput) info(msg string) {
+	o.write(message{Event: "info", Time: time.Now(), Message: msg})
+}
+
+func (o *jsonOutput) best(hashes uint64, elapsed time.Duration, nonce, hash []byte, difficulty uint64, met bool) {
+	o.write(event{
+		Event:      "best",
+		Time:       time.Now(),
+		Hashes:     hashes,
+		Elapsed:    elapsed.Seconds(),
+		HPS:        rate(hashes, elapsed),
+		Nonce:      fmt.Sprintf("%x", nonce),
+		Hash:       fmt.Sprintf("%x", hash),
+		Difficulty: fmt.Sprintf("%016x", difficulty),
+		Target:     met,
+	})
+}
+
+func (o *jsonOutput) status(r report) {
+	e := event{
+		Event:   "status",
+		Time:    time.Now(),
+		Hashes:  r.Hashes,
+		Elapsed: r.Elapsed.Seconds(),
+		HPS:     r.Total.Lifetime,
+		Rates:   &r.Total,
+		Workers: make([]worker, len(r.Workers)),
+	}
+	for w := range r.Workers {
+		e.Workers[w] = worker{Hashes: r.WorkerHashes[w], Rates: r.Workers[w]}
+	}
+	o.write(e)
+}
+
+func (o *jsonOutput) share(job string, nonce []byte, difficulty uint64, err error) {
+	e := event{
+		Event:      "share",
+		Time:       time.Now(),
+		Nonce:      fmt.Sprintf("%x", nonce),
+		Difficulty: fmt.Sprintf("%016x", difficulty),
+		Job:        job,
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	o.write(e)
+}
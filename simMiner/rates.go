@@ -0,0 +1,137 @@
+package main
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Hash rates are worked out from samples of the per worker counters Mine updates.  The instantaneous
+// rate is over the last sampleEvery or so, and the windowed rates over the samples that fall in the
+// window.  Until a run is as long as a window, the windowed rate is the lifetime rate.
+const (
+	sampleEvery = time.Second
+	window1     = time.Minute
+	window5     = 5 * time.Minute
+)
+
+// rates are the hash rates of a worker, or of all of them, in hashes per second
+type rates struct {
+	Now      float64 `json:"now"`
+	Minute   float64 `json:"1m"`
+	Five     float64 `json:"5m"`
+	Lifetime float64 `json:"lifetime"`
+}
+
+// report is the state of a run at a point in time
+type report struct {
+	Hashes       uint64 // Hashes made by all the workers
+	Elapsed      time.Duration
+	Total        rates    // Rates of all the workers together
+	WorkerHashes []uint64 // Hashes made by each worker
+	Workers      []rates  // Rates of each worker
+}
+
+// sample is a snapshot of the counters
+type sample struct {
+	at     time.Time
+	counts []uint64
+}
+
+// count returns the hashes made by worker w, or by all the workers if w < 0
+func (s sample) count(w int) uint64 {
+	if w >= 0 {
+		return s.counts[w]
+	}
+	var total uint64
+	for _, n := range s.counts {
+		total += n
+	}
+	return total
+}
+
+// meter samples the counters of the workers, which they update atomically, and reports hash rates
+// from the samples.  Only total is safe to call concurrently with the others.
+type meter struct {
+	counts  []uint64
+	samples []sample // Oldest first.  The first is the start, and the rest reach back as far as the longest window
+}
+
+func newMeter(counts []uint64, start time.Time) *meter {
+	return &meter{counts: counts, samples: []sample{{at: start, counts: make([]uint64, len(counts))}}}
+}
+
+// total returns the hashes made by all the workers so far
+func (m *meter) total() uint64 {
+	var total uint64
+	for i := range m.counts {
+		total += atomic.LoadUint64(&m.counts[i])
+	}
+	return total
+}
+
+// sample takes a snapshot of the counters, and drops the snapshots that have fallen out of every window
+func (m *meter) sample(now time.Time) {
+	s := sample{at: now, counts: make([]uint64, len(m.counts))}
+	for i := range m.counts {
+		s.counts[i] = atomic.LoadUint64(&m.counts[i])
+	}
+	cutoff := now.Add(-window5)
+	drop := 1
+	for drop < len(m.samples) && m.samples[drop].at.Before(cutoff) {
+		drop++
+	}
+	m.samples = append(append(m.samples[:1], m.samples[drop:]...), s)
+}
+
+// windowStart returns the oldest sample in the window of length d that ends with the latest sample
+func (m *meter) windowStart(d time.Duration) sample {
+	cutoff := m.samples[len(m.samples)-1].at.Add(-d)
+	for _, s := range m.samples {
+		if !s.at.Before(cutoff) {
+			return s
+		}
+	}
+	return m.samples[len(m.samples)-1]
+}
+
+// before returns the newest sample at least d older than the latest sample, or the first sample
+func (m *meter) before(d time.Duration) sample {
+	cutoff := m.samples[len(m.samples)-1].at.Add(-d)
+	for i := len(m.samples) - 1; i > 0; i-- {
+		if !m.samples[i].at.After(cutoff) {
+			return m.samples[i]
+		}
+	}
+	return m.samples[0]
+}
+
+// report samples the counters, and reports the hashes made and the rates as of now
+func (m *meter) report(now time.Time) report {
+	m.sample(now)
+	first := m.samples[0]
+	last := m.samples[len(m.samples)-1]
+	prev := m.before(sampleEvery)
+	from1, from5 := m.windowStart(window1), m.windowStart(window5)
+
+	ratesOf := func(w int) rates {
+		n := last.count(w)
+		return rates{
+			Now:      rate(n-prev.count(w), last.at.Sub(prev.at)),
+			Minute:   rate(n-from1.count(w), last.at.Sub(from1.at)),
+			Five:     rate(n-from5.count(w), last.at.Sub(from5.at)),
+			Lifetime: rate(n, last.at.Sub(first.at)),
+		}
+	}
+
+	r := report{
+		Hashes:       last.count(-1),
+		Elapsed:      last.at.Sub(first.at),
+		Total:        ratesOf(-1),
+		WorkerHashes: last.counts,
+		Workers:      make([]rates, len(last.counts)),
+	}
+	for w := range r.Workers {
+		r.Workers[w] = ratesOf(w)
+	}
+	return r
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMeter(t *testing.T) {
+	counts := make([]uint64, 2)
+	start := time.Unix(1000000, 0)
+	m := newMeter(counts, start)
+
+	// 10 minutes with worker 0 at 100 hps and worker 1 at 50 hps, then 30 seconds with worker 0 at 200 hps
+	now := start
+	for i := 1; i <= 630; i++ {
+		now = start.Add(time.Duration(i) * time.Second)
+		if i <= 600 {
+			counts[0] += 100
+		} else {
+			counts[0] += 200
+		}
+		counts[1] += 50
+		m.sample(now)
+	}
+	if len(m.samples) > int(window5/sampleEvery)+2 {
+		t.Errorf("kept %d samples", len(m.samples))
+	}
+
+	r := m.report(now)
+	near := func(name string, got, want float64) {
+		if math.Abs(got-want) > 0.01 {
+			t.Errorf("%s = %.2f, want %.2f", name, got, want)
+		}
+	}
+	if r.Hashes != counts[0]+counts[1] || r.Elapsed != 630*time.Second {
+		t.Errorf("report of %d hashes in %v", r.Hashes, r.Elapsed)
+	}
+	near("worker 0 now", r.Workers[0].Now, 200)
+	near("worker 0 1m", r.Workers[0].Minute, 150)
+	near("worker 0 5m", r.Workers[0].Five, 110)
+	near("worker 0 lifetime", r.Workers[0].Lifetime, float64(counts[0])/630)
+	near("worker 1 now", r.Workers[1].Now, 50)
+	near("worker 1 5m", r.Workers[1].Five, 50)
+	near("total now", r.Total.Now, 250)
+	near("total 1m", r.Total.Minute, 200)
+	near("total 5m", r.Total.Five, 160)
+	near("total lifetime", r.Total.Lifetime, float64(r.Hashes)/630)
+
+	// A report right after a sample still covers a whole sample period
+	r = m.report(now.Add(time.Millisecond))
+	near("total now after a sample", r.Total.Now, 250/1.001)
+}
+
+func TestMeter_Short(t *testing.T) {
+	counts := make([]uint64, 1)
+	start := time.Unix(1000000, 0)
+	m := newMeter(counts, start)
+	counts[0] = 300
+	r := m.report(start.Add(3 * time.Second))
+	if r.Total.Now != 100 || r.Total.Minute != 100 || r.Total.Five != 100 || r.Total.Lifetime != 100 {
+		t.Errorf("a run shorter than the windows should have the lifetime rate everywhere: %+v", r.Total)
+	}
+}
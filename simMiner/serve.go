@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync/atomic"
+
+	lxr "github.com/pegnet/LXRHash"
+	"github.com/pegnet/LXRHash/pool"
+)
+
+// serve runs the serve subcommand, a pool that simMiner -pool can mine for, and returns the exit status
+func serve(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:8400", "TCP address to listen on")
+	data := fs.String("data", "", "base data to hand out, in hex (default \""+defaultData+"\" as text)")
+	target := fs.Uint64("target", 0xfff0000000000000, "difficulty of a share")
+	rangeSize := fs.Uint64("range", pool.DefaultRangeSize, "nonces in each job")
+	seed := fs.Uint64("seed", lxr.Seed, "seed of the table")
+	passes := fs.Uint64("passes", lxr.Passes, "shuffle passes of the table")
+	bits := fs.Uint64("bits", lxr.MapSizeBits, "bits in the ByteMap index of the table")
+	hashSize := fs.Uint64("hashsize", lxr.HashSize, "bits in the hash")
+	dir := fs.String("dir", "", "directory holding table files (default: see lxr.TableDir)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:\n\nsimMiner serve [flags]\n\nHands out jobs to simMiner -pool, and verifies the shares they find")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	work := []byte(defaultData)
+	if *data != "" {
+		d, err := hex.DecodeString(*data)
+		if err != nil {
+			fmt.Println("bad data:", err)
+			return 2
+		}
+		work = d
+	}
+
+	out := newOutput("text", false, os.Stdout)
+	p := lxr.Params{Seed: *seed, MapSizeBits: *bits, HashSize: *hashSize, Passes: *passes}
+	lx, err := lxr.NewParams(p, lxr.WithDir(*dir), lxr.WithLogger(out))
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	defer lx.Close()
+
+	var shares uint64
+	s := pool.NewServer(lx, pool.ServerOptions{
+		RangeSize: *rangeSize,
+		Target:    *target,
+		Logger:    out,
+		OnShare: func(sh pool.Share) {
+			n := atomic.AddUint64(&shares, 1)
+			out.info(fmt.Sprintf("%10d %16x %8x %s", n, sh.Difficulty, lxr.NonceValue(sh.Nonce), sh.Worker))
+		},
+	})
+	s.SetWork(work)
+
+	l, err := net.Listen("tcp", *listen)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	out.info(fmt.Sprintf("Serving %x on %s", work, l.Addr()))
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	go func() {
+		<-interrupt
+		s.Close()
+	}()
+
+	if err := s.Serve(l); err != pool.ErrServerClosed {
+		fmt.Println(err)
+		return 2
+	}
+	out.info(fmt.Sprintf("Done, %d shares accepted", atomic.LoadUint64(&shares)))
+	return 0
+}
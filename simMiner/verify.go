@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+
+	lxr "github.com/pegnet/LXRHash"
+)
+
+// verify runs the verify subcommand, which checks a table file, and returns the exit status
+func verify(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	seed := fs.Uint64("seed", lxr.Seed, "seed of the table")
+	passes := fs.Uint64("passes", lxr.Passes, "shuffle passes of the table")
+	bits := fs.Uint64("bits", lxr.MapSizeBits, "bits in the ByteMap index of the table")
+	dir := fs.String("dir", "", "directory holding the table (default: see lxr.TableDir)")
+	digest := fs.String("digest", "", "expected sha256 of the ByteMap, in hex (default: the known digest, if any)")
+	regenerate := fs.Bool("regenerate", false, "generate the table in memory and compare it byte for byte (slow)")
+	verbose := fs.Bool("v", false, "print progress")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage:\n\nsimMiner verify [flags]\n\nChecks the table file for the given parameters")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	p := lxr.Params{Seed: *seed, MapSizeBits: *bits, HashSize: lxr.HashSize, Passes: *passes}
+	opts := lxr.VerifyOptions{Dir: *dir, Regenerate: *regenerate}
+	if *digest != "" {
+		d, err := hex.DecodeString(*digest)
+		if err != nil {
+			fmt.Println("bad digest:", err)
+			return 2
+		}
+		opts.Digest = d
+	}
+	if *verbose {
+		opts.Logger = lxr.LoggerFunc(func(level lxr.Level, msg string, kv ...interface{}) {
+			fmt.Println(append([]interface{}{msg}, kv...)...)
+		})
+	}
+
+	r, err := lxr.VerifyTableContext(context.Background(), p, opts)
+	if err != nil {
+		fmt.Println(err)
+		return 2
+	}
+	fmt.Printf("table    %s\n", r.Path)
+	fmt.Printf("version  %d\n", r.Version)
+	fmt.Printf("digest   %x\n", r.Digest)
+	fmt.Printf("balanced %v\n", r.Balanced)
+	if r.DigestChecked {
+		fmt.Printf("known    %v\n", r.DigestMatch)
+	}
+	if r.Regenerated {
+		fmt.Printf("differs  %d bytes\n", r.Mismatches)
+	}
+	if !r.OK() {
+		for _, p := range r.Problems {
+			fmt.Println("PROBLEM ", p)
+		}
+		return 1
+	}
+	fmt.Println("OK")
+	return 0
+}
@@ -1,7 +1,6 @@
 package lxr
 
 import (
-	"fmt"
 	"sync"
 )
 
@@ -20,30 +19,38 @@ func init() {
 // Init provides access to shared instances of LXRHash without having to instantiate multiple bytemaps.
 // Two separate calls to Init() will result in a reference to the same object.
 func Init(seed, bitsize, hashsize, passes uint64) *LXRHash {
-	if bitsize < 8 {
-		panic("bitsize must be at least 8")
+	lxr, err := NewShared(Params{Seed: seed, MapSizeBits: bitsize, HashSize: hashsize, Passes: passes}.Options())
+	if err != nil {
+		panic(err)
 	}
+	return lxr
+}
 
+// NewShared is the error returning form of Init.  Options with the same Params ID share one instance.
+// Every successful call should be paired with a call to Release.  Shared instances are silent unless
+// the Options that create them set Verbose or a Logger.
+func NewShared(opts Options) (*LXRHash, error) {
 	instanceMtx.Lock()
 	defer instanceMtx.Unlock()
 
-	id := fmt.Sprintf("%d-%d-%d-%d", seed, bitsize, hashsize, passes)
-
-	counter[id]++
+	id := opts.Params().ID()
 
 	if instance, ok := instances[id]; ok {
-		return instance
+		counter[id]++
+		return instance, nil
 	}
 
-	lxr := new(LXRHash)
-	lxr.Verbose(true)
-	lxr.Init(seed, bitsize, hashsize, passes)
+	lxr, err := New(opts)
+	if err != nil {
+		return nil, err
+	}
+	counter[id]++
 	instances[id] = lxr
-	return lxr
+	return lxr, nil
 }
 
 // Release releases a singleton. If all references to the singleton have been released, the singleton is destroyed
-// and can be garbage collected
+// and can be garbage collected.  A memory mapped singleton is closed at that point.
 func Release(hash *LXRHash) {
 	if hash == nil {
 		return
@@ -51,7 +58,7 @@ func Release(hash *LXRHash) {
 	instanceMtx.Lock()
 	defer instanceMtx.Unlock()
 
-	id := fmt.Sprintf("%d-%d-%d-%d", hash.Seed, hash.MapSizeBits, hash.HashSize*8, hash.Passes)
+	id := hash.Params().ID()
 	test, exists := instances[id]
 	if !exists || test != hash {
 		panic("tried to release a non-singleton instance")
@@ -60,5 +67,6 @@ func Release(hash *LXRHash) {
 	if counter[id] == 0 {
 		delete(counter, id)
 		delete(instances, id)
+		hash.Close()
 	}
 }
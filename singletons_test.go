@@ -9,6 +9,8 @@ import (
 func testSize(t *testing.T, bits uint64, buf []byte, reference string) {
 	one := Init(Seed, bits, HashSize, Passes)
 	two := Init(Seed, bits, HashSize, Passes)
+	defer Release(one)
+	defer Release(two)
 
 	if one != two {
 		t.Errorf("[%d] two separate pointers for singleton: %x and %x", bits, &one, &two)
@@ -70,3 +72,30 @@ func TestRelease(t *testing.T) {
 		t.Errorf("original singleton was destroyed during release")
 	}
 }
+
+func TestRelease_HashSize(t *testing.T) {
+	// A HashSize that isn't a whole number of bytes is rounded up, and must still release cleanly.
+	// A seed of its own keeps this test clear of instances other tests hold, and a directory of its
+	// own keeps its table out of the real one.
+	dir := t.TempDir()
+	shared := func(hashSize uint64) *LXRHash {
+		lx, err := NewShared(Params{Seed: Seed + 1, MapSizeBits: 8, HashSize: hashSize, Passes: Passes}.Options(WithDir(dir)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lx
+	}
+	one := shared(250)
+	two := shared(256)
+	if one != two {
+		t.Errorf("HashSize 250 and 256 provided different instances")
+	}
+	Release(one)
+	Release(two)
+
+	three := shared(256)
+	defer Release(three)
+	if one == three {
+		t.Errorf("singleton wasn't released after all references destroyed")
+	}
+}
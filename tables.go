@@ -4,10 +4,15 @@ package lxr
 
 import (
 	"bufio"
+	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
-	"os/user"
+	"path/filepath"
+	"runtime"
 	"time"
 )
 
@@ -19,16 +24,41 @@ const (
 	firstv    = uint64(3523455478921636871)
 )
 
-// Verbose enables or disables the output of progress indicators to the console
-func (lx *LXRHash) Verbose(val bool) {
-	lx.verbose = val
-}
+// DirEnv is the environment variable that sets the directory holding table files
+const DirEnv = "LXRHASH_DIR"
+
+// DefaultLockTimeout is how long to wait for another process generating a table before giving up
+const DefaultLockTimeout = 30 * time.Minute
 
-// Log is a wrapper function that only prints information when verbose is enabled
-func (lx *LXRHash) Log(msg string) {
-	if lx.verbose {
-		fmt.Println(msg)
+// TableDir returns the directory that holds table files.  In order of precedence, that is
+//
+//	dir, if it isn't empty
+//	the directory named by the LXRHASH_DIR environment variable
+//	~/.lxrhash, if it already exists
+//	lxrhash in the user's cache directory, i.e. $XDG_CACHE_HOME/lxrhash or ~/.cache/lxrhash on Linux
+func TableDir(dir string) (string, error) {
+	if dir != "" {
+		return dir, nil
+	}
+	if dir := os.Getenv(DirEnv); dir != "" {
+		return dir, nil
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		legacy := filepath.Join(home, ".lxrhash")
+		if fi, err := os.Stat(legacy); err == nil && fi.IsDir() {
+			return legacy, nil
+		}
 	}
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("%w: no table directory given, and %v", ErrTableIO, err)
+	}
+	return filepath.Join(cache, "lxrhash"), nil
+}
+
+// OnProgress sets a function to be called as the table is generated
+func (lx *LXRHash) OnProgress(fn ProgressFunc) {
+	lx.progress = fn
 }
 
 // Init initializes the hash with the given values
@@ -42,128 +72,330 @@ func (lx *LXRHash) Log(msg string) {
 // HashSize is the number of bits in the hash; truncated to a byte bountry
 // Passes is the number of shuffles of the ByteMap performed.  Each pass shuffles all byte values in the map
 func (lx *LXRHash) Init(Seed, MapSizeBits, HashSize, Passes uint64) {
-	if MapSizeBits < 8 {
-		panic(fmt.Sprintf("Bad Map Size in Bits.  Must be between 8 and 34 bits, was %d", MapSizeBits))
+	p := Params{Seed: Seed, MapSizeBits: MapSizeBits, HashSize: HashSize, Passes: Passes}
+	if err := lx.init(context.Background(), p); err != nil {
+		panic(err)
 	}
+}
+
+// init does the work of Init, returning any failure as an error
+func (lx *LXRHash) init(ctx context.Context, p Params) error {
+	if err := lx.setParams(p); err != nil {
+		return err
+	}
+	return lx.readTable(ctx)
+}
 
-	MapSize := uint64(1) << MapSizeBits
-	lx.HashSize = (HashSize + 7) / 8
-	lx.MapSize = MapSize
-	lx.MapSizeBits = MapSizeBits
-	lx.Seed = Seed
-	lx.Passes = Passes
-	lx.ReadTable()
+// setParams validates p and sets the parameters of lx, without loading the ByteMap
+func (lx *LXRHash) setParams(p Params) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
 
+	lx.HashSize = (p.HashSize + 7) / 8
+	lx.MapSize = uint64(1) << p.MapSizeBits
+	lx.MapSizeBits = p.MapSizeBits
+	lx.Seed = p.Seed
+	lx.Passes = p.Passes
+	return nil
 }
 
 // ReadTable attempts to load the ByteMap from disk.
-// If that doesn't exist, a new one will be generated and saved.
+// If that doesn't exist, or fails validation, a new one will be generated and saved.
 func (lx *LXRHash) ReadTable() {
-	u, err := user.Current()
-	if err != nil {
+	if err := lx.readTable(context.Background()); err != nil {
 		panic(err)
 	}
-	userPath := u.HomeDir
-	lxrhashPath := userPath + "/.lxrhash"
-	err = os.MkdirAll(lxrhashPath, os.ModePerm)
+}
+
+// readTable does the work of ReadTable, returning any failure as an error
+func (lx *LXRHash) readTable(ctx context.Context) error {
+	lxrhashPath, err := TableDir(lx.dir)
 	if err != nil {
-		panic(fmt.Sprintf("Could not create the directory %s", lxrhashPath))
+		return err
+	}
+	if !lx.readOnly {
+		err = os.MkdirAll(lxrhashPath, os.ModePerm)
+		if err != nil {
+			return fmt.Errorf("%w: could not create the directory %s: %v", ErrTableIO, lxrhashPath, err)
+		}
 	}
 
-	filename := fmt.Sprintf(lxrhashPath+"/lxrhash-seed-%x-passes-%d-size-%d.dat", lx.Seed, lx.Passes, lx.MapSizeBits)
+	filename := filepath.Join(lxrhashPath, lx.tableName())
 	// Try and load our byte map.
-	lx.Log(fmt.Sprintf("Reading ByteMap Table %s", filename))
+	lx.log(LevelInfo, "Reading ByteMap Table", "path", filename)
+
+	// Reading the table takes a copy of it.  A mapped table only pages in what it uses.
+	if lx.loadMode != LoadMmap {
+		if err := lx.checkMemory(); err != nil {
+			return err
+		}
+	}
 
 	start := time.Now()
-	dat, err := ioutil.ReadFile(filename)
-	// If loading fails, or it is the wrong size, generate it.  Otherwise just use it.
-	if err != nil || len(dat) != int(lx.MapSize) {
-		lx.Log("Table not found, Generating ByteMap Table")
-		lx.GenerateTable()
-		lx.Log("Writing ByteMap Table ")
-		lx.WriteTable(filename)
+	err = lx.loadTable(filename)
+	if err != nil && lx.readOnly {
+		if errors.Is(err, ErrTableCorrupt) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", ErrTableIO, err)
+	}
+	// If loading fails, or the table is not valid, generate it.  Otherwise just use it.
+	if err != nil {
+		// Only one process generates a table.  Any others wait for the lock, then load the table
+		// the first one wrote.
+		timeout := lx.lockTimeout
+		if timeout == 0 {
+			timeout = DefaultLockTimeout
+		}
+		lx.log(LevelDebug, "Locking ByteMap Table", "path", filename+".lock")
+		unlock, err := lockFile(ctx, filename+".lock", timeout)
+		if err != nil {
+			if errors.Is(err, ErrLockTimeout) || ctx.Err() != nil {
+				return err
+			}
+			return fmt.Errorf("%w: could not lock %s: %v", ErrTableIO, filename, err)
+		}
+		defer unlock()
+
+		if err := lx.loadTable(filename); err != nil {
+			lx.log(LevelInfo, "Table not found, Generating ByteMap Table", "path", filename)
+			if err := lx.checkMemory(); err != nil {
+				return err
+			}
+			if err := lx.GenerateTableContext(ctx); err != nil {
+				lx.ByteMap = nil
+				return err
+			}
+			sum := sha256.Sum256(lx.ByteMap)
+			if err := lx.checkDigest(sum[:]); err != nil {
+				lx.log(LevelError, "Generated table is not the known table", "path", filename, "error", err)
+				lx.ByteMap = nil
+				return err
+			}
+			lx.log(LevelInfo, "Writing ByteMap Table", "path", filename)
+			if err := lx.writeTable(filename); err != nil {
+				return err
+			}
+			// Switch to the shared mapping of the table we just wrote, rather than keep our own copy
+			if lx.loadMode == LoadMmap {
+				if err := lx.loadTable(filename); err != nil {
+					lx.log(LevelWarn, "Could not map the table, keeping the generated table in memory", "path", filename, "error", err)
+				}
+			}
+		}
+	}
+	lx.log(LevelInfo, "Finished Reading ByteMap Table", "path", filename, "elapsed", time.Since(start))
+	return nil
+}
+
+// tableName returns the name of the table file holding the ByteMap of lx
+func (lx *LXRHash) tableName() string {
+	return fmt.Sprintf("lxrhash-seed-%x-passes-%d-size-%d.dat", lx.Seed, lx.Passes, lx.MapSizeBits)
+}
+
+// loadTable loads and validates the ByteMap in filename, using the load mode of lx.
+// If the table is memory mapped and the platform does not support it, the table is read instead.
+func (lx *LXRHash) loadTable(filename string) error {
+	lx.Close()
+
+	var dat []byte
+	var err error
+	if lx.loadMode == LoadMmap {
+		dat, err = mmapFile(filename)
+		if err == nil {
+			lx.mapping = dat
+		} else if err == errNoMmap {
+			lx.log(LevelWarn, "Reading the table instead of mapping it", "path", filename, "error", err)
+			dat, err = ioutil.ReadFile(filename)
+		}
 	} else {
-		lx.ByteMap = dat
+		dat, err = ioutil.ReadFile(filename)
+	}
+	if err != nil {
+		return err
+	}
+
+	byteMap, err := lx.decodeTable(dat)
+	if err != nil {
+		lx.log(LevelWarn, "Table is not valid", "path", filename, "error", err)
+		lx.Close()
+		return err
 	}
-	lx.Log(fmt.Sprintf("Finished Reading ByteMap Table. Total time taken: %s", time.Since(start)))
+	lx.ByteMap = byteMap
+	return nil
 }
 
-// WriteTable caches the bytemap to disk so it only has to be generated once
+// Close releases the memory mapped ByteMap, if any.  The LXRHash cannot be used to hash after
+// it is closed.  Close does nothing if the ByteMap was not memory mapped.
+func (lx *LXRHash) Close() error {
+	if lx.mapping == nil {
+		return nil
+	}
+	err := munmap(lx.mapping)
+	lx.mapping = nil
+	lx.ByteMap = nil
+	return err
+}
+
+// WriteTable caches the bytemap to disk so it only has to be generated once.  The file is written
+// in the current table file format, with a header that lets ReadTable validate it.
+//
+// The table is written to a temporary file in the same directory, synced, and then renamed into
+// place, so a crash part way through never leaves a partial table under filename.
 func (lx *LXRHash) WriteTable(filename string) {
-	os.Remove(filename)
+	if err := lx.writeTable(filename); err != nil {
+		panic(err)
+	}
+}
 
-	// open output file
-	fo, err := os.Create(filename)
+// writeTable does the work of WriteTable, returning any failure as an error
+func (lx *LXRHash) writeTable(filename string) error {
+	err := WriteFileAtomic(filename, 0644, func(w io.Writer) error {
+		// write the header, then the ByteMap a chunk at a time
+		if _, err := w.Write(lx.tableHeader()); err != nil {
+			return fmt.Errorf("error writing table header: %v", err)
+		}
+		bufSize := 4096 // 4KiB
+		for i := 0; i < len(lx.ByteMap); i += bufSize {
+			j := i + bufSize
+			if j > len(lx.ByteMap) {
+				j = len(lx.ByteMap)
+			}
+			if nn, err := w.Write(lx.ByteMap[i:j]); err != nil {
+				return fmt.Errorf("error writing bytemap to disk: %d bytes written, %v", nn, err)
+			}
+		}
+		return nil
+	})
 	if err != nil {
-		panic(err)
+		return fmt.Errorf("%w: %v", ErrTableIO, err)
+	}
+	return nil
+}
+
+// WriteFileAtomic replaces filename with what write writes, with permissions perm.  What is written
+// goes to a temporary file next to filename, which is synced and then renamed over filename, so a
+// process killed, or a machine that crashes, part way through leaves either the old file or the new
+// one, never a mix.
+func WriteFileAtomic(filename string, perm os.FileMode, write func(w io.Writer) error) (err error) {
+	dir := filepath.Dir(filename)
+
+	// open a temporary output file next to filename
+	fo, err := ioutil.TempFile(dir, filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
 	}
-	// close fo on exit and check for its returned error
+	// close fo on exit, and get rid of it if it didn't make it into place
 	defer func() {
-		if err := fo.Close(); err != nil {
-			panic(err)
+		fo.Close()
+		if err != nil {
+			os.Remove(fo.Name())
 		}
 	}()
 
-	// write a chunk
 	w := bufio.NewWriter(fo)
-	bufSize := 4096 // 4KiB
-	for i := 0; i < len(lx.ByteMap); i += bufSize {
-		j := i + bufSize
-		if j > len(lx.ByteMap) {
-			j = len(lx.ByteMap)
-		}
-		if nn, err := w.Write(lx.ByteMap[i:j]); err != nil {
-			panic(fmt.Sprintf("error writing bytemap to disk: %d bytes written, %v", nn, err))
-		}
+	if err := write(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := fo.Chmod(perm); err != nil {
+		return err
 	}
-	err = w.Flush()
+	if err := fo.Sync(); err != nil {
+		return err
+	}
+	if err := fo.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(fo.Name(), filename); err != nil {
+		return err
+	}
+	return syncDir(dir)
+}
+
+// syncDir flushes a directory to disk, so a file renamed into it survives a crash
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil // Windows can't sync a directory, and renames are journaled by NTFS
+	}
+	d, err := os.Open(dir)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer d.Close()
+	return d.Sync()
 }
 
 // GenerateTable generates the bytemap.
 // Initializes the map with an incremental sequence of bytes,
 // then does P passes, shuffling each element in a deterministic manner.
+//
+// Each shuffle depends on a read of the ByteMap as shuffled so far, so the work is inherently serial.
+// The loop is kept tight instead: all the generator state lives in locals, and progress is only
+// checked once per block of indexes rather than on every index.  Where supported, the ByteMap is
+// backed by huge pages to cut the cost of the random accesses.
 func (lx *LXRHash) GenerateTable() {
-	lx.ByteMap = make([]byte, int(lx.MapSize))
+	lx.GenerateTableContext(context.Background())
+}
+
+// GenerateTableContext is GenerateTable, stopping early with an error when ctx is done.  Progress is
+// reported to the function set with OnProgress as the table is shuffled.
+func (lx *LXRHash) GenerateTableContext(ctx context.Context) error {
+	byteMap := make([]byte, int(lx.MapSize))
+	adviseHugePages(byteMap)
+	lx.ByteMap = byteMap
 	// Our own "random" generator that really is just used to shuffle values
 	offset := lx.Seed ^ firstrand
 	b := lx.Seed ^ firstb
 	v := firstv
 	MapMask := lx.MapSize - 1
-	// The random index used to shuffle the ByteMap is itself computed through the ByteMap table
-	// in a deterministic pattern.
-	rand := func(i uint64) int64 {
-		offset = offset<<9 ^ offset>>1 ^ offset>>7 ^ b
-		v = uint64(lx.ByteMap[(offset^b)&MapMask]) ^ v<<8 ^ v>>1
-		b = v<<7 ^ v<<13 ^ v<<33 ^ v<<52 ^ b<<9 ^ b>>1
-		return int64(uint64(offset) & uint64(MapMask))
-	}
 
 	// Fill the ByteMap with bytes ranging from 0 to 255.  As long as Mapsize%256 == 0, this
 	// looping and masking works just fine.
-	lx.Log("Initializing the Table")
-	for i := range lx.ByteMap {
-		lx.ByteMap[i] = byte(i)
+	lx.log(LevelDebug, "Initializing the Table", "size", len(byteMap))
+	for i := range byteMap {
+		byteMap[i] = byte(i)
 	}
 
 	// Now what we want to do is just mix it all up.  Take every byte in the ByteMap list, and exchange it
 	// for some other byte in the ByteMap list. Note that we do this over and over, mixing and more mixing
 	// the ByteMap, but maintaining the ratio of each byte value in the ByteMap list.
-	lx.Log("Shuffling the Table")
+	lx.log(LevelInfo, "Shuffling the Table", "passes", lx.Passes)
+	const block = 1 << 16
 	period := time.Now().Unix()
 	for loops := 0; loops < int(lx.Passes); loops++ {
-		lx.Log(fmt.Sprintf("Pass %d", loops))
-		for i := range lx.ByteMap {
-			if (i+1)%1000 == 0 && time.Now().Unix()-period > 10 {
-				lx.Log(fmt.Sprintf(" Index %10d Meg of %10d Meg -- Pass is %5.1f%% Complete", i/1024000, len(lx.ByteMap)/1024000, 100*float64(i)/float64(len(lx.ByteMap))))
+		lx.log(LevelInfo, "Pass", "pass", loops)
+		passStart := time.Now()
+		for start := 0; start < len(byteMap); start += block {
+			if err := ctx.Err(); err != nil {
+				return fmt.Errorf("lxr: table generation stopped: %w", err)
+			}
+			if time.Now().Unix()-period > 10 {
+				lx.log(LevelInfo, "Shuffling", "pass", loops, "index", start, "size", len(byteMap), "complete", fmt.Sprintf("%.1f%%", 100*float64(start)/float64(len(byteMap))))
 				period = time.Now().Unix()
 			}
 
-			j := rand(uint64(i))
-			lx.ByteMap[i], lx.ByteMap[j] = lx.ByteMap[j], lx.ByteMap[i]
+			end := start + block
+			if end > len(byteMap) {
+				end = len(byteMap)
+			}
+			for i := start; i < end; i++ {
+				// The random index used to shuffle the ByteMap is itself computed through the ByteMap table
+				// in a deterministic pattern.
+				offset = offset<<9 ^ offset>>1 ^ offset>>7 ^ b
+				v = uint64(byteMap[(offset^b)&MapMask]) ^ v<<8 ^ v>>1
+				b = v<<7 ^ v<<13 ^ v<<33 ^ v<<52 ^ b<<9 ^ b>>1
+				j := offset & MapMask
+				byteMap[i], byteMap[j] = byteMap[j], byteMap[i]
+			}
+			if lx.progress != nil {
+				lx.progress(loops, int(lx.Passes), uint64(end), lx.MapSize)
+			}
 		}
-		lx.Log(fmt.Sprintf(" Index %10d Meg of %10d Meg -- Pass is %5.1f%% Complete", len(lx.ByteMap)/1024000, len(lx.ByteMap)/1024000, float64(100)))
+		lx.log(LevelInfo, "Pass complete", "pass", loops, "elapsed", time.Since(passStart))
 	}
+	return nil
 }
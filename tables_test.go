@@ -2,8 +2,13 @@ package lxr
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
@@ -90,8 +95,11 @@ func compareWrite(t *testing.T, MapSizeBits uint64) {
 		panic(err)
 	}
 
-	if !bytes.Equal(a, b) {
-		t.Errorf("mismatch for %d bits. old = %32x, new = %32x", MapSizeBits, a, b)
+	if !bytes.Equal(b[:tableHeaderSize], l.tableHeader()) {
+		t.Errorf("bad header for %d bits. %x", MapSizeBits, b[:tableHeaderSize])
+	}
+	if !bytes.Equal(a, b[tableHeaderSize:]) {
+		t.Errorf("mismatch for %d bits. old = %32x, new = %32x", MapSizeBits, a, b[tableHeaderSize:])
 	}
 }
 
@@ -101,3 +109,272 @@ func TestLXRHash_WriteTable(t *testing.T) {
 	compareWrite(t, 16)
 	compareWrite(t, 20)
 }
+
+func TestTableDir(t *testing.T) {
+	home, err := ioutil.TempDir("", "lxrhome")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CACHE_HOME", filepath.Join(home, "xdg"))
+	t.Setenv(DirEnv, "")
+
+	check := func(dir, want string) {
+		got, err := TableDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("TableDir(%q) = %s, want = %s", dir, got, want)
+		}
+	}
+
+	check("", filepath.Join(home, "xdg", "lxrhash"))
+	if err := os.Mkdir(filepath.Join(home, ".lxrhash"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	check("", filepath.Join(home, ".lxrhash"))
+	t.Setenv(DirEnv, "/env/dir")
+	check("", "/env/dir")
+	check("/opt/dir", "/opt/dir")
+}
+
+func TestReadTable_ReadOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := Options{Seed: Seed, MapSizeBits: 10, HashSize: HashSize, Passes: Passes, Dir: dir, ReadOnly: true}
+	if _, err := New(opts); !errors.Is(err, ErrTableIO) {
+		t.Errorf("expected ErrTableIO for a missing table, got %v", err)
+	}
+
+	opts.ReadOnly = false
+	want, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.dat"))
+	if len(files) != 1 {
+		t.Fatalf("expected one table file in %s, found %v", dir, files)
+	}
+
+	opts.ReadOnly = true
+	l, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, want.ByteMap) {
+		t.Errorf("read only table differs from the generated table")
+	}
+
+	// Damage the table.  Read only fails, otherwise the table is regenerated.
+	dat, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	dat[len(dat)-1] ^= 0xFF
+	if err := ioutil.WriteFile(files[0], dat, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(opts); !errors.Is(err, ErrTableCorrupt) {
+		t.Errorf("expected ErrTableCorrupt for a damaged table, got %v", err)
+	}
+	opts.ReadOnly = false
+	if l, err = New(opts); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(l.ByteMap, want.ByteMap) {
+		t.Errorf("regenerated table differs from the generated table")
+	}
+	opts.ReadOnly = true
+	if _, err := New(opts); err != nil {
+		t.Errorf("damaged table was not replaced: %v", err)
+	}
+}
+
+func TestLXRHash_WriteTableReplace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l := new(LXRHash)
+	l.Init(Seed, 8, HashSize, Passes)
+
+	filename := filepath.Join(dir, "table.dat")
+	if err := ioutil.WriteFile(filename, []byte("partial table"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	l.WriteTable(filename)
+
+	dat, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bm, err := l.decodeTable(dat); err != nil || !bytes.Equal(bm, l.ByteMap) {
+		t.Errorf("table was not replaced: %v", err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected only the table in %s, found %d files", dir, len(files))
+	}
+}
+
+func TestWriteFileAtomic_Fail(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(filename, []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	failed := errors.New("failed")
+	err := WriteFileAtomic(filename, 0644, func(w io.Writer) error {
+		w.Write([]byte("new"))
+		return failed
+	})
+	if err != failed {
+		t.Errorf("expected the error of the write, got %v", err)
+	}
+	if dat, _ := ioutil.ReadFile(filename); string(dat) != "old" {
+		t.Errorf("file was changed to %q", dat)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected only the file in %s, found %d files", dir, len(files))
+	}
+}
+
+// OldGenerateTable is the original GenerateTable, kept as the reference for its output
+// Initializes the map with an incremental sequence of bytes,
+// then does P passes, shuffling each element in a deterministic manner.
+func (lx *LXRHash) OldGenerateTable() {
+	lx.ByteMap = make([]byte, int(lx.MapSize))
+	// Our own "random" generator that really is just used to shuffle values
+	offset := lx.Seed ^ firstrand
+	b := lx.Seed ^ firstb
+	v := firstv
+	MapMask := lx.MapSize - 1
+	// The random index used to shuffle the ByteMap is itself computed through the ByteMap table
+	// in a deterministic pattern.
+	rand := func(i uint64) int64 {
+		offset = offset<<9 ^ offset>>1 ^ offset>>7 ^ b
+		v = uint64(lx.ByteMap[(offset^b)&MapMask]) ^ v<<8 ^ v>>1
+		b = v<<7 ^ v<<13 ^ v<<33 ^ v<<52 ^ b<<9 ^ b>>1
+		return int64(uint64(offset) & uint64(MapMask))
+	}
+
+	// Fill the ByteMap with bytes ranging from 0 to 255.  As long as Mapsize%256 == 0, this
+	// looping and masking works just fine.
+	lx.Log("Initializing the Table")
+	for i := range lx.ByteMap {
+		lx.ByteMap[i] = byte(i)
+	}
+
+	// Now what we want to do is just mix it all up.  Take every byte in the ByteMap list, and exchange it
+	// for some other byte in the ByteMap list. Note that we do this over and over, mixing and more mixing
+	// the ByteMap, but maintaining the ratio of each byte value in the ByteMap list.
+	lx.Log("Shuffling the Table")
+	period := time.Now().Unix()
+	for loops := 0; loops < int(lx.Passes); loops++ {
+		lx.Log(fmt.Sprintf("Pass %d", loops))
+		for i := range lx.ByteMap {
+			if (i+1)%1000 == 0 && time.Now().Unix()-period > 10 {
+				lx.Log(fmt.Sprintf(" Index %10d Meg of %10d Meg -- Pass is %5.1f%% Complete", i/1024000, len(lx.ByteMap)/1024000, 100*float64(i)/float64(len(lx.ByteMap))))
+				period = time.Now().Unix()
+			}
+
+			j := rand(uint64(i))
+			lx.ByteMap[i], lx.ByteMap[j] = lx.ByteMap[j], lx.ByteMap[i]
+		}
+		lx.Log(fmt.Sprintf(" Index %10d Meg of %10d Meg -- Pass is %5.1f%% Complete", len(lx.ByteMap)/1024000, len(lx.ByteMap)/1024000, float64(100)))
+	}
+}
+
+func TestLXRHash_GenerateTable(t *testing.T) {
+	for bits := uint64(8); bits <= 24; bits += 4 {
+		l := new(LXRHash)
+		l.MapSizeBits = bits
+		l.MapSize = uint64(1) << bits
+		l.Seed = Seed
+		l.Passes = Passes
+
+		l.OldGenerateTable()
+		want := l.ByteMap
+		l.GenerateTable()
+
+		if !bytes.Equal(l.ByteMap, want) {
+			t.Errorf("mismatch for %d bits. old = %32x, new = %32x", bits, want, l.ByteMap)
+		}
+	}
+}
+
+func BenchmarkLXRHash_GenerateTable(b *testing.B) {
+	l := new(LXRHash)
+	l.MapSizeBits = 20
+	l.MapSize = uint64(1) << l.MapSizeBits
+	l.Seed = Seed
+	l.Passes = Passes
+
+	b.Run("old", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			l.OldGenerateTable()
+		}
+	})
+	b.Run("new", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			l.GenerateTable()
+		}
+	})
+}
+
+func TestLXRHash_GenerateTableProgress(t *testing.T) {
+	l := new(LXRHash)
+	l.MapSizeBits = 18
+	l.MapSize = uint64(1) << l.MapSizeBits
+	l.Seed = Seed
+	l.Passes = Passes
+
+	var calls, lastPass int
+	var lastDone uint64
+	l.OnProgress(func(pass, passes int, done, total uint64) {
+		calls++
+		if passes != int(Passes) || total != l.MapSize {
+			t.Errorf("bad progress totals: passes = %d, total = %d", passes, total)
+		}
+		if pass == lastPass && done <= lastDone || pass != lastPass && pass != lastPass+1 {
+			t.Errorf("progress went backwards: pass %d done %d after pass %d done %d", pass, done, lastPass, lastDone)
+		}
+		lastPass, lastDone = pass, done
+	})
+	if err := l.GenerateTableContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls == 0 || lastPass != int(Passes)-1 || lastDone != l.MapSize {
+		t.Errorf("progress did not finish: %d calls, last pass %d done %d", calls, lastPass, lastDone)
+	}
+}
+
+func TestNewContext_Cancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lxrtables")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := Options{Seed: Seed, MapSizeBits: 20, HashSize: HashSize, Passes: Passes, Dir: dir}
+	opts.Progress = func(pass, passes int, done, total uint64) {
+		if pass == 1 {
+			cancel()
+		}
+	}
+	if _, err := NewContext(ctx, opts); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.dat")); len(files) != 0 {
+		t.Errorf("cancelled generation wrote a table: %v", files)
+	}
+}
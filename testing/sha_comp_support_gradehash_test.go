@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/dustin/go-humanize"
+	lxr "github.com/pegnet/LXRHash"
 )
 
 // Routines for collecting stats on Hashing algorithms and comparing them to other
@@ -95,7 +96,7 @@ func (g *Gradehash) AddHash(src []byte, hash []byte) {
 	g.bitsDelta += changedhere
 	g.last = hash
 
-	diff := Difficulty(hash)
+	diff := lxr.Difficulty(hash)
 	if diff > g.difficulty {
 		g.difficulty = diff
 		g.diffHash = hash
@@ -179,19 +180,6 @@ func (g *Gradehash) Report(name string) (hashcount string, report string) {
 	return
 }
 
-// Consider a bigger number to be more difficult.  (This is a bit different
-// than most PoW.  It is the same as viewing the return value as signed, and
-// saying a smaller value is more difficult, due to the nature of signed
-// values in binary.
-func Difficulty(hash []byte) uint64 {
-	// Calculate the Difficulty
-	diff := uint64(0)
-	for i := 0; i < 8; i++ {
-		diff = diff<<8 + uint64(hash[i])
-	}
-	return diff
-}
-
 func Getbuf(length int) []byte {
 	//buflen := minsample + rand.Intn(maxsample)
 	nbuf := make([]byte, length)
@@ -0,0 +1,71 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Submission is a claimed PoW result, along with the parameters of the hash it claims to use
+type Submission struct {
+	Params        Params // Parameters of the LXRHash the Hash was made with
+	Data          []byte // The data that was mined
+	Nonce         []byte // The nonce appended to Data
+	Hash          []byte // The claimed hash of Data followed by Nonce
+	MinDifficulty uint64 // The least difficulty the Hash must have
+}
+
+// Verify checks a claimed PoW result.  It returns an error wrapping ErrParamsMismatch if p are not
+// the parameters of lx, ErrHashMismatch if claimed is not the hash of data followed by nonce, or
+// ErrInsufficientDifficulty if the hash is below minDifficulty.
+func (lx *LXRHash) Verify(p Params, data, nonce, claimed []byte, minDifficulty uint64) error {
+	if p.canonical() != lx.Params() {
+		return fmt.Errorf("%w: hash made with %+v, verifying with %+v", ErrParamsMismatch, p, lx.Params())
+	}
+
+	src := make([]byte, 0, len(data)+len(nonce))
+	src = append(append(src, data...), nonce...)
+	hash := make([]byte, lx.HashSize)
+	lx.HashInto(hash, src)
+
+	if !bytes.Equal(hash, claimed) {
+		return fmt.Errorf("%w: got %x, claimed %x", ErrHashMismatch, hash, claimed)
+	}
+	if d := Difficulty(hash); d < minDifficulty {
+		return fmt.Errorf("%w: %016x is less than %016x", ErrInsufficientDifficulty, d, minDifficulty)
+	}
+	return nil
+}
+
+// VerifyBatch verifies a set of submissions, i.e. all the PoW results in a block, spread over all
+// the CPUs.  The error for each submission is at the same index in the result, and is nil if the
+// submission is valid.
+func (lx *LXRHash) VerifyBatch(subs []Submission) []error {
+	errs := make([]error, len(subs))
+
+	var next int
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU() && w < len(subs); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				mtx.Lock()
+				i := next
+				next++
+				mtx.Unlock()
+				if i >= len(subs) {
+					return
+				}
+				s := subs[i]
+				errs[i] = lx.Verify(s.Params, s.Data, s.Nonce, s.Hash, s.MinDifficulty)
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
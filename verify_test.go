@@ -0,0 +1,66 @@
+package lxr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLXRHash_Verify(t *testing.T) {
+	l := new(LXRHash)
+	l.Init(Seed, 8, HashSize, Passes)
+	p := l.Params()
+	if p != (Params{Seed: Seed, MapSizeBits: 8, HashSize: HashSize, Passes: Passes}) {
+		t.Fatalf("unexpected params %+v", p)
+	}
+
+	data := []byte("some opr")
+	nonce := []byte{1, 2, 3}
+	hash := l.Hash(append(append([]byte{}, data...), nonce...))
+	diff := Difficulty(hash)
+
+	if err := l.Verify(p, data, nonce, hash, diff); err != nil {
+		t.Errorf("valid submission failed: %v", err)
+	}
+	// A hash size that rounds up to the same number of bytes is the same hash
+	if err := l.Verify(Params{Seed, 8, HashSize - 7, Passes}, data, nonce, hash, diff); err != nil {
+		t.Errorf("valid submission failed with an unrounded hash size: %v", err)
+	}
+
+	bad := append([]byte{}, hash...)
+	bad[5] ^= 1
+
+	tests := []struct {
+		name string
+		err  error
+		sub  Submission
+	}{
+		{"seed", ErrParamsMismatch, Submission{Params{Seed + 1, 8, HashSize, Passes}, data, nonce, hash, 0}},
+		{"bits", ErrParamsMismatch, Submission{Params{Seed, 9, HashSize, Passes}, data, nonce, hash, 0}},
+		{"size", ErrParamsMismatch, Submission{Params{Seed, 8, HashSize + 8, Passes}, data, nonce, hash, 0}},
+		{"passes", ErrParamsMismatch, Submission{Params{Seed, 8, HashSize, Passes + 1}, data, nonce, hash, 0}},
+		{"hash", ErrHashMismatch, Submission{p, data, nonce, bad, 0}},
+		{"nonce", ErrHashMismatch, Submission{p, data, []byte{1, 2, 4}, hash, 0}},
+		{"difficulty", ErrInsufficientDifficulty, Submission{p, data, nonce, hash, diff + 1}},
+		{"valid", nil, Submission{p, data, nonce, hash, diff}},
+	}
+
+	subs := make([]Submission, len(tests))
+	for i, tt := range tests {
+		s := tt.sub
+		err := l.Verify(s.Params, s.Data, s.Nonce, s.Hash, s.MinDifficulty)
+		if !errors.Is(err, tt.err) || (tt.err == nil) != (err == nil) {
+			t.Errorf("[%s] expected %v, got %v", tt.name, tt.err, err)
+		}
+		subs[i] = s
+	}
+
+	errs := l.VerifyBatch(subs)
+	if len(errs) != len(tests) {
+		t.Fatalf("expected %d results, got %d", len(tests), len(errs))
+	}
+	for i, tt := range tests {
+		if !errors.Is(errs[i], tt.err) || (tt.err == nil) != (errs[i] == nil) {
+			t.Errorf("[%s] batch expected %v, got %v", tt.name, tt.err, errs[i])
+		}
+	}
+}
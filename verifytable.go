@@ -0,0 +1,160 @@
+// Copyright (c) of parts are held by the various contributors
+// Licensed under the MIT License. See LICENSE file in the project root for full license information.
+package lxr
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// VerifyOptions controls the checks VerifyTable makes beyond the ones it always makes
+type VerifyOptions struct {
+	Dir        string       // Directory holding the table file.  See TableDir for the default
+	Digest     []byte       // Expected sha256 of the ByteMap.  Defaults to KnownDigest
+	Regenerate bool         // Generate the table in memory and compare it byte for byte.  As slow as generating it
+	Progress   ProgressFunc // Called as the table is regenerated
+	Logger     Logger       // Receives log events
+}
+
+// Report is the result of VerifyTable.  Problems lists everything found wrong with the table, and
+// the other fields give the details.
+type Report struct {
+	Params  Params
+	Path    string      // The table file verified
+	Version uint32      // Format version of the file, 0 for a legacy file without a header
+	Digest  []byte      // sha256 of the ByteMap
+	Counts  [256]uint64 // Number of times each byte value appears in the ByteMap
+
+	Balanced      bool   // Every byte value appears MapSize/256 times, as it does in any table GenerateTable makes
+	DigestChecked bool   // The ByteMap was compared against a known digest
+	DigestMatch   bool   // The ByteMap matched the known digest
+	Regenerated   bool   // The ByteMap was compared against a freshly generated one
+	Mismatches    uint64 // Number of bytes that differ from the regenerated ByteMap
+	FirstMismatch uint64 // Index of the first byte that differs from the regenerated ByteMap
+
+	Problems []string
+}
+
+// OK returns true if no problems were found with the table
+func (r *Report) OK() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *Report) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// VerifyTable checks the table file for p in the default table directory, without using or changing it.
+// See VerifyTableContext.
+func VerifyTable(p Params) (Report, error) {
+	return VerifyTableContext(context.Background(), p, VerifyOptions{})
+}
+
+// VerifyTableContext checks the table file for p.  The file's header, if it has one, must match p and
+// the ByteMap, every byte value must appear equally often in the ByteMap, and the ByteMap must match its
+// known digest, if there is one.  With opts, the ByteMap is also compared against a freshly generated one.
+//
+// Whatever is found wrong with the table is listed in the Problems of the Report.  An error is only
+// returned if the table can't be checked at all, i.e. p is invalid or the file can't be read.
+func VerifyTableContext(ctx context.Context, p Params, opts VerifyOptions) (Report, error) {
+	r := Report{Params: p}
+	lx := new(LXRHash)
+	if err := lx.setParams(p); err != nil {
+		return r, err
+	}
+	lx.logger = opts.Logger
+	lx.progress = opts.Progress
+
+	dir, err := TableDir(opts.Dir)
+	if err != nil {
+		return r, err
+	}
+	r.Path = filepath.Join(dir, lx.tableName())
+	if err := lx.checkMemory(); err != nil {
+		return r, err
+	}
+	lx.log(LevelInfo, "Verifying ByteMap Table", "path", r.Path)
+	dat, err := ioutil.ReadFile(r.Path)
+	if err != nil {
+		return r, fmt.Errorf("%w: %v", ErrTableIO, err)
+	}
+
+	byteMap := dat
+	var checksum []byte
+	if !isLegacyTable(dat, lx.MapSize) {
+		hdr, b, err := parseTableHeader(dat)
+		r.Version = hdr.Version
+		if err != nil {
+			r.problem("%v", err)
+			return r, nil
+		}
+		if hdr.Seed != lx.Seed || hdr.Passes != lx.Passes || hdr.MapSizeBits != lx.MapSizeBits {
+			r.problem("header is for seed %x, passes %d, size %d", hdr.Seed, hdr.Passes, hdr.MapSizeBits)
+		}
+		byteMap = b
+		if uint64(len(byteMap)) != lx.MapSize {
+			r.problem("ByteMap is %d bytes, expected %d", len(byteMap), lx.MapSize)
+			return r, nil
+		}
+		checksum = hdr.Sum
+	}
+
+	sum := sha256.Sum256(byteMap)
+	r.Digest = sum[:]
+	if checksum != nil && !bytes.Equal(r.Digest, checksum) {
+		r.problem("ByteMap does not match the checksum in the header")
+	}
+	known := opts.Digest
+	if known == nil {
+		known, _ = KnownDigest(p)
+	}
+	if known != nil {
+		r.DigestChecked = true
+		r.DigestMatch = bytes.Equal(r.Digest, known)
+		if !r.DigestMatch {
+			r.problem("ByteMap digest %x does not match the known digest %x", r.Digest, known)
+		}
+	}
+
+	for _, v := range byteMap {
+		r.Counts[v]++
+	}
+	unbalanced := 0
+	for _, n := range r.Counts {
+		if n != lx.MapSize/256 {
+			unbalanced++
+		}
+	}
+	r.Balanced = unbalanced == 0
+	if !r.Balanced {
+		r.problem("%d byte values do not appear %d times each", unbalanced, lx.MapSize/256)
+	}
+
+	if opts.Regenerate {
+		lx.log(LevelInfo, "Regenerating ByteMap Table", "path", r.Path)
+		if err := lx.checkMemory(); err != nil {
+			return r, err
+		}
+		if err := lx.GenerateTableContext(ctx); err != nil {
+			return r, err
+		}
+		r.Regenerated = true
+		for i, v := range lx.ByteMap {
+			if byteMap[i] != v {
+				if r.Mismatches == 0 {
+					r.FirstMismatch = uint64(i)
+				}
+				r.Mismatches++
+			}
+		}
+		if r.Mismatches > 0 {
+			r.problem("%d bytes differ from the regenerated ByteMap, the first at index %d", r.Mismatches, r.FirstMismatch)
+		}
+	}
+	lx.log(LevelInfo, "Finished Verifying ByteMap Table", "path", r.Path, "problems", len(r.Problems))
+	return r, nil
+}
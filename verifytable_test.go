@@ -0,0 +1,78 @@
+package lxr
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyTable(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	p := Params{Seed: Seed, MapSizeBits: 10, HashSize: HashSize, Passes: Passes}
+	if _, err := VerifyTableContext(ctx, p, VerifyOptions{Dir: dir}); !errors.Is(err, ErrTableIO) {
+		t.Errorf("expected ErrTableIO for a missing table, got %v", err)
+	}
+
+	l, err := NewParams(p, WithDir(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := l.tableHeader()[32:64]
+
+	r, err := VerifyTableContext(ctx, p, VerifyOptions{Dir: dir, Digest: digest, Regenerate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.OK() || !r.Balanced || !r.DigestChecked || !r.DigestMatch || !r.Regenerated || r.Mismatches != 0 {
+		t.Errorf("valid table failed verification: %+v", r)
+	}
+	if r.Version != TableFormatVersion || r.Path != filepath.Join(dir, l.tableName()) {
+		t.Errorf("wrong version %d or path %s", r.Version, r.Path)
+	}
+
+	// Swap two different bytes.  The table stays balanced, but no longer matches.
+	file, err := ioutil.ReadFile(r.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := tableHeaderSize + 10
+	j := i + 1
+	for file[j] == file[i] {
+		j++
+	}
+	file[i], file[j] = file[j], file[i]
+	if err := ioutil.WriteFile(r.Path, file, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err = VerifyTableContext(ctx, p, VerifyOptions{Dir: dir, Digest: digest, Regenerate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.OK() || !r.Balanced || r.DigestMatch || r.Mismatches != 2 || r.FirstMismatch != 10 {
+		t.Errorf("swapped bytes not found: %+v", r)
+	}
+	if len(r.Problems) != 3 { // checksum, digest, regenerated
+		t.Errorf("expected 3 problems, got %q", r.Problems)
+	}
+
+	// A legacy table with a byte changed is unbalanced
+	legacy := file[tableHeaderSize:]
+	legacy[0]++
+	if err := ioutil.WriteFile(r.Path, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err = VerifyTableContext(ctx, p, VerifyOptions{Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.OK() || r.Balanced || r.Version != 0 || !r.DigestChecked || r.DigestMatch || r.Regenerated {
+		t.Errorf("unbalanced legacy table not found: %+v", r)
+	}
+
+	if _, err := VerifyTableContext(ctx, Params{MapSizeBits: 40, HashSize: HashSize}, VerifyOptions{Dir: dir}); !errors.Is(err, ErrBadMapSize) {
+		t.Errorf("expected ErrBadMapSize, got %v", err)
+	}
+}